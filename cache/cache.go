@@ -0,0 +1,186 @@
+package cache
+
+import (
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/janosgyerik/dupfinder/utils"
+)
+
+// bump when the meaning of stored digests changes, to discard old caches
+const formatVersion = 2
+
+// Cache stores digests of files across runs. Entries are keyed by the
+// identity of the file (device and inode where available, otherwise path)
+// and the name of the hash algorithm, and are only returned while
+// the size and modification time still match.
+type Cache interface {
+	Get(path string, info os.FileInfo, hash string) (partial, full string, ok bool)
+	Put(path string, info os.FileInfo, hash, partial, full string)
+	Prune() int
+	Save() error
+	Len() int
+}
+
+type key struct {
+	Device uint64
+	Inode  uint64
+	Path   string
+	Hash   string
+}
+
+type entry struct {
+	Path    string
+	Size    int64
+	ModTime int64
+	Partial string
+	Full    string
+}
+
+type contents struct {
+	Version int
+	Entries map[key]entry
+}
+
+type fileCache struct {
+	mutex   sync.Mutex
+	path    string
+	entries map[key]entry
+	dirty   bool
+}
+
+func keyOf(path string, info os.FileInfo, hash string) key {
+	if id, ok := utils.FileIDOf(info); ok {
+		return key{Device: id.Device, Inode: id.Inode, Hash: hash}
+	}
+	return key{Path: path, Hash: hash}
+}
+
+func matches(e entry, info os.FileInfo) bool {
+	return e.Size == info.Size() && e.ModTime == info.ModTime().UnixNano()
+}
+
+func (c *fileCache) Get(path string, info os.FileInfo, hash string) (string, string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, ok := c.entries[keyOf(path, info, hash)]
+	if !ok || !matches(e, info) {
+		return "", "", false
+	}
+	return e.Partial, e.Full, true
+}
+
+func (c *fileCache) Put(path string, info os.FileInfo, hash, partial, full string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries[keyOf(path, info, hash)] = entry{
+		Path:    path,
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Partial: partial,
+		Full:    full,
+	}
+	c.dirty = true
+}
+
+// Prune drops the entries of files that no longer exist or have changed,
+// and returns the number of entries dropped
+func (c *fileCache) Prune() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	removed := 0
+	for k, e := range c.entries {
+		info, err := os.Stat(e.Path)
+		if err != nil || keyOf(e.Path, info, k.Hash) != k || !matches(e, info) {
+			delete(c.entries, k)
+			removed++
+		}
+	}
+	if removed > 0 {
+		c.dirty = true
+	}
+	return removed
+}
+
+func (c *fileCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.entries)
+}
+
+// Save writes the cache to its file if anything changed,
+// replacing the previous file atomically
+func (c *fileCache) Save() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	dir := filepath.Dir(c.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, filepath.Base(c.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = gob.NewEncoder(tmp).Encode(contents{formatVersion, c.entries})
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+// Open loads the cache stored in the file at path.
+// A missing file or a file written by an incompatible version
+// yields an empty cache, that will be saved to the same path.
+func Open(path string) (Cache, error) {
+	c := &fileCache{path: path, entries: make(map[key]entry)}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var stored contents
+	if err := gob.NewDecoder(f).Decode(&stored); err != nil {
+		return nil, err
+	}
+	if stored.Version == formatVersion && stored.Entries != nil {
+		c.entries = stored.Entries
+	}
+	return c, nil
+}
+
+// DefaultPath returns the location of the cache file under the user's
+// cache directory, that is $XDG_CACHE_HOME/dupfinder on Linux
+func DefaultPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "dupfinder", "hashes.db"), nil
+}
@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/janosgyerik/dupfinder/utils"
+)
+
+func newTempDir() string {
+	tempdir, err := ioutil.TempDir("", "test")
+	utils.PanicIfFailed(err)
+	return tempdir
+}
+
+func writeFile(path, content string) os.FileInfo {
+	utils.PanicIfFailed(ioutil.WriteFile(path, []byte(content), 0644))
+	info, err := os.Stat(path)
+	utils.PanicIfFailed(err)
+	return info
+}
+
+func Test_Get_returns_stored_digests_until_file_changes(t *testing.T) {
+	tempdir := newTempDir()
+	defer os.RemoveAll(tempdir)
+
+	file := filepath.Join(tempdir, "file")
+	info := writeFile(file, "foo")
+
+	c, err := Open(filepath.Join(tempdir, "cache.db"))
+	utils.PanicIfFailed(err)
+
+	if _, _, ok := c.Get(file, info, "sha256"); ok {
+		t.Fatal("got entry from empty cache")
+	}
+
+	c.Put(file, info, "sha256", "partial", "full")
+	if partial, full, ok := c.Get(file, info, "sha256"); !ok || partial != "partial" || full != "full" {
+		t.Fatalf("got %q, %q, %v; expected stored digests", partial, full, ok)
+	}
+
+	later := time.Now().Add(time.Hour)
+	utils.PanicIfFailed(os.Chtimes(file, later, later))
+	changed, err := os.Stat(file)
+	utils.PanicIfFailed(err)
+
+	if _, _, ok := c.Get(file, changed, "sha256"); ok {
+		t.Fatal("got entry for modified file")
+	}
+}
+
+func Test_Get_returns_digests_of_the_same_hash_only(t *testing.T) {
+	tempdir := newTempDir()
+	defer os.RemoveAll(tempdir)
+
+	file := filepath.Join(tempdir, "file")
+	info := writeFile(file, "foo")
+
+	c, err := Open(filepath.Join(tempdir, "cache.db"))
+	utils.PanicIfFailed(err)
+
+	c.Put(file, info, "sha256", "partial", "full")
+	if _, _, ok := c.Get(file, info, "xxh64"); ok {
+		t.Fatal("got entry of another hash")
+	}
+
+	c.Put(file, info, "xxh64", "p", "f")
+	if partial, full, ok := c.Get(file, info, "sha256"); !ok || partial != "partial" || full != "full" {
+		t.Fatalf("got %q, %q, %v; expected digests stored for sha256", partial, full, ok)
+	}
+}
+
+func Test_Save_and_Open(t *testing.T) {
+	tempdir := newTempDir()
+	defer os.RemoveAll(tempdir)
+
+	file := filepath.Join(tempdir, "file")
+	info := writeFile(file, "foo")
+
+	path := filepath.Join(tempdir, "sub", "cache.db")
+	c, err := Open(path)
+	utils.PanicIfFailed(err)
+	c.Put(file, info, "sha256", "partial", "full")
+	utils.PanicIfFailed(c.Save())
+
+	reopened, err := Open(path)
+	utils.PanicIfFailed(err)
+	if partial, full, ok := reopened.Get(file, info, "sha256"); !ok || partial != "partial" || full != "full" {
+		t.Fatalf("got %q, %q, %v; expected stored digests", partial, full, ok)
+	}
+}
+
+func Test_Open_corrupt_file_fails(t *testing.T) {
+	tempdir := newTempDir()
+	defer os.RemoveAll(tempdir)
+
+	path := filepath.Join(tempdir, "cache.db")
+	writeFile(path, "garbage")
+
+	if _, err := Open(path); err == nil {
+		t.Fatal("expected error for corrupt cache file")
+	}
+}
+
+func Test_Prune_drops_deleted_and_changed_files(t *testing.T) {
+	tempdir := newTempDir()
+	defer os.RemoveAll(tempdir)
+
+	kept := filepath.Join(tempdir, "kept")
+	deleted := filepath.Join(tempdir, "deleted")
+	changed := filepath.Join(tempdir, "changed")
+
+	c, err := Open(filepath.Join(tempdir, "cache.db"))
+	utils.PanicIfFailed(err)
+	for _, path := range []string{kept, deleted, changed} {
+		c.Put(path, writeFile(path, "foo"), "sha256", "partial", "full")
+	}
+
+	utils.PanicIfFailed(os.Remove(deleted))
+	writeFile(changed, "longer content")
+
+	if removed := c.Prune(); removed != 2 {
+		t.Errorf("got %d entries removed; expected 2", removed)
+	}
+	if c.Len() != 1 {
+		t.Errorf("got %d entries left; expected 1", c.Len())
+	}
+}
@@ -0,0 +1,68 @@
+package checkpoint
+
+import (
+	"encoding/gob"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/janosgyerik/dupfinder"
+)
+
+// bump when the meaning of stored snapshots changes
+const formatVersion = 1
+
+// ErrIncompatible is returned by Load for checkpoints written by
+// an incompatible version
+var ErrIncompatible = errors.New("incompatible checkpoint format")
+
+type contents struct {
+	Version  int
+	Snapshot dupfinder.Snapshot
+}
+
+// Save writes the snapshot to the file at path,
+// replacing the previous checkpoint atomically
+func Save(path string, snapshot dupfinder.Snapshot) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = gob.NewEncoder(tmp).Encode(contents{formatVersion, snapshot})
+	if syncErr := tmp.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load reads the snapshot saved in the file at path
+func Load(path string) (dupfinder.Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return dupfinder.Snapshot{}, err
+	}
+	defer f.Close()
+
+	var stored contents
+	if err := gob.NewDecoder(f).Decode(&stored); err != nil {
+		return dupfinder.Snapshot{}, err
+	}
+	if stored.Version != formatVersion {
+		return dupfinder.Snapshot{}, &os.PathError{Op: "load", Path: path, Err: ErrIncompatible}
+	}
+	return stored.Snapshot, nil
+}
@@ -0,0 +1,49 @@
+package checkpoint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/janosgyerik/dupfinder"
+	"github.com/janosgyerik/dupfinder/utils"
+)
+
+func Test_Save_and_Load(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "test")
+	utils.PanicIfFailed(err)
+	defer os.RemoveAll(tempdir)
+
+	snapshot := dupfinder.Snapshot{
+		Files: []dupfinder.SnapshotFile{
+			{Path: "a", Size: 3, ModTime: time.Unix(1500000000, 123), Partial: "p", Full: "f"},
+			{Path: "b", Size: 5, ModTime: time.Unix(1600000000, 0), Sampled: "s"},
+		},
+		Sampling: &dupfinder.Sampling{HeadPercent: 10, TailPercent: 10, Blocks: 8},
+	}
+
+	path := filepath.Join(tempdir, "sub", "scan.checkpoint")
+	utils.PanicIfFailed(Save(path, snapshot))
+
+	loaded, err := Load(path)
+	utils.PanicIfFailed(err)
+
+	for i := range loaded.Files {
+		if !loaded.Files[i].ModTime.Equal(snapshot.Files[i].ModTime) {
+			t.Errorf("got mtime %v; expected %v", loaded.Files[i].ModTime, snapshot.Files[i].ModTime)
+		}
+		loaded.Files[i].ModTime = snapshot.Files[i].ModTime
+	}
+	if !reflect.DeepEqual(snapshot, loaded) {
+		t.Errorf("got:\n%#v\nexpected:\n%#v", loaded, snapshot)
+	}
+}
+
+func Test_Load_missing_file(t *testing.T) {
+	if _, err := Load("/nonexistent/checkpoint"); !os.IsNotExist(err) {
+		t.Errorf("got %v; expected not exist error", err)
+	}
+}
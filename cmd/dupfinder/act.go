@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/janosgyerik/dupfinder/dedupe"
+)
+
+var keepPolicies = []string{"oldest", "newest", "shortest-path", "first-arg", "regex"}
+
+func parseKeepPolicy(flags *flag.FlagSet, name, regex string, roots []string) dedupe.KeepPolicy {
+	switch name {
+	case "oldest":
+		return dedupe.KeepPolicies.Oldest
+	case "newest":
+		return dedupe.KeepPolicies.Newest
+	case "shortest-path":
+		return dedupe.KeepPolicies.ShortestPath
+	case "first-arg":
+		if len(roots) == 0 {
+			exitWithError(flags, fmt.Errorf("-keep first-arg requires paths as arguments"))
+		}
+		return dedupe.KeepPolicies.FirstArg(roots)
+	case "regex":
+		if _, err := regexp.Compile(regex); err != nil {
+			exitWithError(flags, err)
+		}
+		return dedupe.KeepPolicies.Regex(regex)
+	}
+	exitWithError(flags, fmt.Errorf("invalid keep policy: %q", name))
+	return nil
+}
+
+// actCommand implements "dupfinder act", that finds duplicates
+// and deletes or replaces them with links to the kept file
+func actCommand(args []string) {
+	flags := flag.NewFlagSet("act", flag.ExitOnError)
+	scan := addScanFlags(flags)
+
+	var actions []string
+	for _, action := range dedupe.Actions {
+		actions = append(actions, string(action))
+	}
+	actionPtr := flags.String("action", "", "what to do with duplicates: "+strings.Join(actions, ", "))
+	keepPtr := flags.String("keep", "", "which file to keep in each group: "+strings.Join(keepPolicies, ", "))
+	keepRegexPtr := flags.String("keep-regex", "", "with -keep regex, keep the first path that matches regex; groups without a match are left alone")
+	dryRunPtr := flags.Bool("dry-run", true, "only print what would be done; use -dry-run=false to apply")
+	journalPtr := flags.String("journal", "", "path of the journal of changes (default under the user cache directory)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: dupfinder act -action ACTION -keep POLICY [options] [paths...]")
+		fmt.Fprintln(os.Stderr, "Find duplicates and delete them or replace them with links to the kept file.")
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(args)
+
+	action, err := dedupe.ParseAction(*actionPtr)
+	if err != nil {
+		exitWithError(flags, err)
+	}
+	params := scan.params(flags)
+	policy := parseKeepPolicy(flags, *keepPtr, *keepRegexPtr, params.roots)
+
+	tracker := scanPaths(params)
+	if params.ctx.Err() != nil {
+		printLine("Interrupted, nothing changed.")
+		finish(params)
+		return
+	}
+	ops := dedupe.Plan(tracker.Groups(), action, policy)
+
+	if *dryRunPtr {
+		for _, op := range ops {
+			fmt.Println("would", op)
+		}
+		printLine("Dry run, nothing changed. Use -dry-run=false to apply.")
+		finish(params)
+		return
+	}
+
+	journalPath := *journalPtr
+	if journalPath == "" {
+		journalPath, err = dedupe.DefaultJournalPath()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+	}
+	journal, err := dedupe.OpenJournal(journalPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+	defer journal.Close()
+
+	done := 0
+	for _, op := range ops {
+		if params.ctx.Err() != nil {
+			printLine("Interrupted, stopping.")
+			break
+		}
+		if err := dedupe.Apply(op, journal); errors.Is(err, dedupe.ErrNotConfirmed) {
+			fmt.Fprintln(os.Stderr, "warning:", err)
+		} else if err != nil {
+			skipped.addError(err)
+			continue
+		}
+		fmt.Println(op)
+		done++
+	}
+
+	printLine("Operations done:", done, "of", len(ops))
+	printLine("Journal:", journal.Path())
+	finish(params)
+}
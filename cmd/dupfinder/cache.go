@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/janosgyerik/dupfinder/cache"
+)
+
+func openCache(path string) (cache.Cache, error) {
+	if path == "" {
+		defaultPath, err := cache.DefaultPath()
+		if err != nil {
+			return nil, err
+		}
+		path = defaultPath
+	}
+	return cache.Open(path)
+}
+
+// cacheCommand implements "dupfinder cache prune [-cache PATH]"
+func cacheCommand(args []string) {
+	flags := flag.NewFlagSet("cache", flag.ExitOnError)
+	cachePathPtr := flags.String("cache", "", "path of the hash cache file (default under the user cache directory)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: dupfinder cache prune [options]")
+		fmt.Fprintln(os.Stderr, "Drop cached hashes of files that were deleted or changed.")
+		flags.PrintDefaults()
+	}
+
+	if len(args) == 0 || args[0] != "prune" {
+		flags.Usage()
+		os.Exit(1)
+	}
+	flags.Parse(args[1:])
+
+	c, err := openCache(*cachePathPtr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+
+	removed := c.Prune()
+	if err := c.Save(); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Removed %d entries, %d left\n", removed, c.Len())
+}
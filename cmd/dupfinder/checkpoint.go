@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/janosgyerik/dupfinder"
+	"github.com/janosgyerik/dupfinder/checkpoint"
+)
+
+// number of files to add between checkpoints, at most
+const checkpointBatchSize = 1000
+
+func channelOf(paths []string) <-chan string {
+	ch := make(chan string)
+	go func() {
+		for _, path := range paths {
+			ch <- path
+		}
+		close(ch)
+	}()
+	return ch
+}
+
+// addWithCheckpoints adds the paths in batches, and saves the state of the
+// tracker to the checkpoint file after a batch once the interval has passed
+// since the last save, and when done or interrupted
+func addWithCheckpoints(ctx context.Context, tracker dupfinder.Tracker, paths []string, path string, interval time.Duration) []error {
+	var errs []error
+	last := time.Now()
+	save := func() {
+		if err := checkpoint.Save(path, tracker.Snapshot()); err != nil {
+			fmt.Fprintln(os.Stderr, "warning: could not save checkpoint:", err)
+		}
+		last = time.Now()
+	}
+
+	for start := 0; start < len(paths) && ctx.Err() == nil; start += checkpointBatchSize {
+		end := start + checkpointBatchSize
+		if end > len(paths) {
+			end = len(paths)
+		}
+		errs = append(errs, tracker.AddAllContext(ctx, channelOf(paths[start:end]))...)
+		if time.Since(last) >= interval {
+			save()
+		}
+	}
+	save()
+	return errs
+}
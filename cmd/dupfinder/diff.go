@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/janosgyerik/dupfinder"
+	"github.com/janosgyerik/dupfinder/utils"
+)
+
+type moveRecord struct {
+	A []string `json:"a"`
+	B []string `json:"b"`
+}
+
+type diffRecord struct {
+	OnlyInA   []string     `json:"only_in_a"`
+	OnlyInB   []string     `json:"only_in_b"`
+	Changed   []string     `json:"changed"`
+	Moved     []moveRecord `json:"moved"`
+	Identical int          `json:"identical"`
+}
+
+// writeDiff writes the differences of two trees in the specified format.
+// The text format is a line per difference, like git diff --name-status:
+// a status letter, and the paths separated by tabs.
+func writeDiff(w io.Writer, format string, diff dupfinder.TreeDiff) error {
+	if format == "json" {
+		record := diffRecord{OnlyInA: diff.OnlyInA, OnlyInB: diff.OnlyInB, Changed: diff.Changed, Moved: []moveRecord{}, Identical: diff.Identical}
+		for _, move := range diff.Moved {
+			record.Moved = append(record.Moved, moveRecord{A: move.A, B: move.B})
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(record)
+	}
+
+	for _, path := range diff.OnlyInA {
+		fmt.Fprintf(w, "D\t%s\n", path)
+	}
+	for _, path := range diff.OnlyInB {
+		fmt.Fprintf(w, "A\t%s\n", path)
+	}
+	for _, path := range diff.Changed {
+		fmt.Fprintf(w, "M\t%s\n", path)
+	}
+	for _, move := range diff.Moved {
+		for _, a := range move.A {
+			for _, b := range move.B {
+				if _, err := fmt.Fprintf(w, "R\t%s\t%s\n", a, b); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// diffCommand implements "dupfinder diff A B", that compares
+// two directory trees by the content of their files
+func diffCommand(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	scan := addScanFlags(flags)
+	formatPtr := flags.String("format", "text", "output format: text, json")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: dupfinder diff [options] A B")
+		fmt.Fprintln(os.Stderr, "Compare two directory trees by the content of their files, listing with")
+		fmt.Fprintln(os.Stderr, "D the files only in A, A the files only in B, M the paths with different content,")
+		fmt.Fprintln(os.Stderr, "and R the content at different paths. Exit status is 1 if the trees differ.")
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(args)
+	if flags.NArg() != 2 || *scan.stdin || *scan.zero {
+		flags.Usage()
+		os.Exit(1)
+	}
+	if !isFlagSet(flags, "minSize") {
+		*scan.minSize = "0"
+	}
+	if *formatPtr != "text" && *formatPtr != "json" {
+		exitWithError(flags, fmt.Errorf("invalid format: %q", *formatPtr))
+	}
+
+	a := filepath.Clean(flags.Arg(0))
+	b := filepath.Clean(flags.Arg(1))
+	if utils.IsUnder(a, b) || utils.IsUnder(b, a) {
+		exitWithError(flags, errors.New("the trees to compare must not contain each other"))
+	}
+
+	params := scan.params(flags)
+	tracker := scanPaths(params)
+	diff := tracker.Diff(a, b)
+
+	if err := writeDiff(os.Stdout, *formatPtr, diff); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+	printLine(fmt.Sprintf("Only in A: %d, only in B: %d, changed: %d, moved: %d, identical: %d",
+		len(diff.OnlyInA), len(diff.OnlyInB), len(diff.Changed), len(diff.Moved), diff.Identical))
+
+	finish(params)
+	if !diff.Empty() {
+		os.Exit(1)
+	}
+}
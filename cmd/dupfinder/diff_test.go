@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/janosgyerik/dupfinder"
+)
+
+var testDiff = dupfinder.TreeDiff{
+	OnlyInA:   []string{"deleted"},
+	OnlyInB:   []string{"added"},
+	Changed:   []string{"changed"},
+	Moved:     []dupfinder.Move{{A: []string{"old"}, B: []string{"new1", "new2"}}},
+	Identical: 3,
+}
+
+func Test_writeDiff_text(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeDiff(&buf, "text", testDiff); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "D\tdeleted\nA\tadded\nM\tchanged\nR\told\tnew1\nR\told\tnew2\n"
+	if actual := buf.String(); actual != expected {
+		t.Errorf("got %q; expected %q", actual, expected)
+	}
+}
+
+func Test_writeDiff_json(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeDiff(&buf, "json", testDiff); err != nil {
+		t.Fatal(err)
+	}
+
+	var record diffRecord
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	expected := diffRecord{
+		OnlyInA:   []string{"deleted"},
+		OnlyInB:   []string{"added"},
+		Changed:   []string{"changed"},
+		Moved:     []moveRecord{{A: []string{"old"}, B: []string{"new1", "new2"}}},
+		Identical: 3,
+	}
+	if !reflect.DeepEqual(expected, record) {
+		t.Errorf("got:\n%#v\nexpected:\n%#v", record, expected)
+	}
+}
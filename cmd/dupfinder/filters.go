@@ -0,0 +1,169 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/janosgyerik/dupfinder/finder"
+)
+
+// stringList is a flag that may be repeated, collecting all values
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// fileFlags are the flags that select files by their attributes
+type fileFlags struct {
+	maxSize     *string
+	path        *string
+	globs       stringList
+	excludeGlob stringList
+	ext         *string
+	newer       *string
+	older       *string
+	user        *string
+	group       *string
+	perm        *string
+}
+
+func addFileFlags(flags *flag.FlagSet) *fileFlags {
+	f := &fileFlags{
+		maxSize: flags.String("maxSize", "", "maximum file size"),
+		path:    flags.String("path", "", "include files whose full path matches regex"),
+		ext:     flags.String("ext", "", "include files with one of these comma-separated extensions, ignoring case"),
+		newer:   flags.String("newer", "", "include files modified after a date (2006-01-02 or RFC 3339) or a duration ago (such as 12h or 7d)"),
+		older:   flags.String("older", "", "include files modified before a date or a duration ago, see -newer"),
+		user:    flags.String("user", "", "include files owned by user name or id"),
+		group:   flags.String("group", "", "include files owned by group name or id"),
+		perm:    flags.String("perm", "", "include files with all these octal permission bits set, such as 0111"),
+	}
+	flags.Var(&f.globs, "glob", "include filenames that match the glob pattern; may be repeated to match any")
+	flags.Var(&f.excludeGlob, "exclude-glob", "exclude filenames that match the glob pattern; may be repeated")
+	return f
+}
+
+// filters validates the flags and returns the filters they select
+func (f *fileFlags) filters(flags *flag.FlagSet, now time.Time) []finder.Filter {
+	var filters []finder.Filter
+	check := func(err error) {
+		if err != nil {
+			exitWithError(flags, err)
+		}
+	}
+
+	if *f.maxSize != "" {
+		maxSize, err := toByteCount(*f.maxSize)
+		check(err)
+		filters = append(filters, finder.Filters.MaxSize(maxSize))
+	}
+	if *f.path != "" {
+		_, err := regexp.Compile(*f.path)
+		check(err)
+		filters = append(filters, finder.Filters.PathRegex(*f.path))
+	}
+	if len(f.globs) > 0 {
+		filters = append(filters, finder.Filters.Or(globFilters(flags, f.globs)...))
+	}
+	if len(f.excludeGlob) > 0 {
+		filters = append(filters, finder.Filters.Not(finder.Filters.Or(globFilters(flags, f.excludeGlob)...)))
+	}
+	if *f.ext != "" {
+		filters = append(filters, finder.Filters.Extensions(strings.Split(*f.ext, ",")...))
+	}
+	if *f.newer != "" {
+		t, err := parseTime(*f.newer, now)
+		check(err)
+		filters = append(filters, finder.Filters.NewerThan(t))
+	}
+	if *f.older != "" {
+		t, err := parseTime(*f.older, now)
+		check(err)
+		filters = append(filters, finder.Filters.OlderThan(t))
+	}
+	if *f.user != "" {
+		uid, err := lookupID(*f.user, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		check(err)
+		filters = append(filters, finder.Filters.Owner(uid))
+	}
+	if *f.group != "" {
+		gid, err := lookupID(*f.group, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		check(err)
+		filters = append(filters, finder.Filters.Group(gid))
+	}
+	if *f.perm != "" {
+		perm, err := strconv.ParseUint(*f.perm, 8, 32)
+		if err != nil || perm > 0777 {
+			exitWithError(flags, fmt.Errorf("invalid permission bits: %q", *f.perm))
+		}
+		filters = append(filters, finder.Filters.Perm(os.FileMode(perm)))
+	}
+	return filters
+}
+
+func globFilters(flags *flag.FlagSet, patterns []string) []finder.Filter {
+	var filters []finder.Filter
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			exitWithError(flags, fmt.Errorf("invalid glob pattern %q: %v", pattern, err))
+		}
+		filters = append(filters, finder.Filters.Glob(pattern))
+	}
+	return filters
+}
+
+// parseTime parses a date, or a duration before now,
+// where durations may also be in days, such as 7d
+func parseTime(s string, now time.Time) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if strings.HasSuffix(s, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil {
+			return now.AddDate(0, 0, -days), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date or duration: %q", s)
+}
+
+// lookupID returns the numeric id, or looks up the id of the name
+func lookupID(s string, lookup func(name string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(s); err == nil {
+		return id, nil
+	}
+	id, err := lookup(s)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(id)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_parseTime(t *testing.T) {
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.Local)
+	data := []struct {
+		s        string
+		expected time.Time
+	}{
+		{"2020-01-02", time.Date(2020, 1, 2, 0, 0, 0, 0, time.Local)},
+		{"2020-01-02T03:04:05Z", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"7d", time.Date(2020, 3, 3, 12, 0, 0, 0, time.Local)},
+		{"90m", time.Date(2020, 3, 10, 10, 30, 0, 0, time.Local)},
+	}
+	for _, item := range data {
+		actual, err := parseTime(item.s, now)
+		if err != nil || !actual.Equal(item.expected) {
+			t.Errorf("parseTime(%q) = %v, %v; expected %v", item.s, actual, err, item.expected)
+		}
+	}
+
+	if _, err := parseTime("yesterday", now); err == nil {
+		t.Error("expected error for invalid time")
+	}
+}
+
+func Test_lookupID(t *testing.T) {
+	lookup := func(name string) (string, error) {
+		if name == "alice" {
+			return "1001", nil
+		}
+		return "", errors.New("unknown")
+	}
+
+	if id, err := lookupID("42", lookup); err != nil || id != 42 {
+		t.Errorf("got %d, %v; expected 42", id, err)
+	}
+	if id, err := lookupID("alice", lookup); err != nil || id != 1001 {
+		t.Errorf("got %d, %v; expected 1001", id, err)
+	}
+	if _, err := lookupID("bob", lookup); err == nil {
+		t.Error("expected error for unknown name")
+	}
+}
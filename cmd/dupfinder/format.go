@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/janosgyerik/dupfinder"
+	"github.com/janosgyerik/dupfinder/utils"
+)
+
+var formats = []string{"text", "json", "ndjson", "csv", "null"}
+
+func isValidFormat(format string) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+type fileRecord struct {
+	Path      string    `json:"path"`
+	ModTime   time.Time `json:"mtime"`
+	Device    uint64    `json:"device,omitempty"`
+	Inode     uint64    `json:"inode,omitempty"`
+	Reference bool      `json:"reference,omitempty"`
+}
+
+type groupRecord struct {
+	Size      int64        `json:"size"`
+	Hash      string       `json:"hash,omitempty"`
+	Algorithm string       `json:"algorithm,omitempty"`
+	Probable  bool         `json:"probable,omitempty"`
+	Files     []fileRecord `json:"files"`
+}
+
+func newGroupRecord(group dupfinder.Group) groupRecord {
+	record := groupRecord{Size: group.Size, Hash: group.Digest, Algorithm: group.Algorithm, Probable: group.Probable}
+	for i, path := range group.Paths {
+		file := fileRecord{Path: path, Reference: group.IsReference(i)}
+		if info := group.Infos[i]; info != nil {
+			file.ModTime = info.ModTime()
+			if id, ok := utils.FileIDOf(info); ok {
+				file.Device = id.Device
+				file.Inode = id.Inode
+			}
+		}
+		record.Files = append(record.Files, file)
+	}
+	return record
+}
+
+// linkRecord is a set of paths that are hard links of the same file
+type linkRecord struct {
+	Linked []string `json:"linked"`
+}
+
+// writeGroups writes the groups of duplicate files in the specified format,
+// followed by the sets of hard links, except in null format
+func writeGroups(w io.Writer, format string, groups []dupfinder.Group, links [][]string) error {
+	switch format {
+	case "json":
+		records := make([]interface{}, 0)
+		for _, group := range groups {
+			records = append(records, newGroupRecord(group))
+		}
+		for _, paths := range links {
+			records = append(records, linkRecord{paths})
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+
+	case "ndjson":
+		encoder := json.NewEncoder(w)
+		for _, group := range groups {
+			if err := encoder.Encode(newGroupRecord(group)); err != nil {
+				return err
+			}
+		}
+		for _, paths := range links {
+			if err := encoder.Encode(linkRecord{paths}); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"group", "size", "hash", "probable", "path", "mtime", "device", "inode", "algorithm", "reference", "kind"})
+		for i, group := range groups {
+			record := newGroupRecord(group)
+			for _, file := range record.Files {
+				writer.Write([]string{
+					strconv.Itoa(i + 1),
+					strconv.FormatInt(record.Size, 10),
+					record.Hash,
+					strconv.FormatBool(record.Probable),
+					file.Path,
+					file.ModTime.Format(time.RFC3339Nano),
+					strconv.FormatUint(file.Device, 10),
+					strconv.FormatUint(file.Inode, 10),
+					record.Algorithm,
+					strconv.FormatBool(file.Reference),
+					"duplicate",
+				})
+			}
+		}
+		// hard links have only a path
+		for i, paths := range links {
+			for _, path := range paths {
+				writer.Write([]string{strconv.Itoa(len(groups) + i + 1), "", "", "", path, "", "", "", "", "", "linked"})
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+
+	case "null":
+		// each path terminated by a null, each group by an extra null;
+		// hard links are left out, as they would look like duplicates
+		for _, group := range groups {
+			for _, path := range group.Paths {
+				if _, err := fmt.Fprintf(w, "%s\000", path); err != nil {
+					return err
+				}
+			}
+			if _, err := fmt.Fprint(w, "\000"); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		for _, group := range groups {
+			if ref := firstReference(group); ref >= 0 {
+				if err := writeCopies(w, group, ref); err != nil {
+					return err
+				}
+				continue
+			}
+			if group.Probable {
+				fmt.Fprintln(w, "# file sizes:", group.Size, "(probable duplicates, not verified)")
+			} else {
+				fmt.Fprintf(w, "# file sizes: %d %s: %s\n", group.Size, group.Algorithm, group.Digest)
+			}
+			for _, path := range group.Paths {
+				fmt.Fprintln(w, path)
+			}
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		return writeLinks(w, links)
+	}
+}
+
+func firstReference(group dupfinder.Group) int {
+	for i := range group.Paths {
+		if group.IsReference(i) {
+			return i
+		}
+	}
+	return -1
+}
+
+// writeCopies writes the files of a group that are not reference files,
+// after a header line with the path of the reference file they are copies of
+func writeCopies(w io.Writer, group dupfinder.Group, ref int) error {
+	if group.Probable {
+		fmt.Fprintln(w, "# copies of:", group.Paths[ref], "(probable duplicates, not verified)")
+	} else {
+		fmt.Fprintln(w, "# copies of:", group.Paths[ref])
+	}
+	for i, path := range group.Paths {
+		if !group.IsReference(i) {
+			fmt.Fprintln(w, path)
+		}
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// writePaths writes a list of paths in the specified format
+func writePaths(w io.Writer, format string, paths []string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(paths)
+
+	case "ndjson":
+		encoder := json.NewEncoder(w)
+		for _, path := range paths {
+			if err := encoder.Encode(path); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"path"})
+		for _, path := range paths {
+			writer.Write([]string{path})
+		}
+		writer.Flush()
+		return writer.Error()
+
+	case "null":
+		for _, path := range paths {
+			if _, err := fmt.Fprintf(w, "%s\000", path); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		for _, path := range paths {
+			if _, err := fmt.Fprintln(w, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// writeLinks writes the sets of paths that are hard links of the same file,
+// that are not counted as duplicates, since they take no extra space
+func writeLinks(w io.Writer, links [][]string) error {
+	for _, paths := range links {
+		fmt.Fprintln(w, "# already linked:", len(paths), "paths")
+		for _, path := range paths {
+			fmt.Fprintln(w, path)
+		}
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
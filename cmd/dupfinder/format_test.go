@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/janosgyerik/dupfinder"
+)
+
+var testGroups = []dupfinder.Group{
+	{Paths: []string{"a/f1", "b/f1"}, Infos: make([]os.FileInfo, 2), Size: 3, Digest: "abc", Algorithm: "sha256"},
+	{Paths: []string{"c/with\nnewline", "d/f2"}, Infos: make([]os.FileInfo, 2), Size: 5, Probable: true},
+}
+
+var testLinks = [][]string{{"e/f3", "f/f3"}}
+
+func Test_writeGroups_json(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeGroups(&buf, "json", testGroups, testLinks); err != nil {
+		t.Fatal(err)
+	}
+
+	var records []struct {
+		groupRecord
+		linkRecord
+	}
+	if err := json.Unmarshal(buf.Bytes(), &records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[0].Hash != "abc" || records[0].Algorithm != "sha256" || !records[1].Probable || records[1].Files[0].Path != "c/with\nnewline" {
+		t.Errorf("unexpected records: %#v", records)
+	}
+	if !reflect.DeepEqual(testLinks[0], records[2].Linked) || records[2].Files != nil {
+		t.Errorf("unexpected links record: %#v", records[2])
+	}
+}
+
+func Test_writeGroups_ndjson(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeGroups(&buf, "ndjson", testGroups, testLinks); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines; expected 3", len(lines))
+	}
+	var record groupRecord
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Size != 5 || len(record.Files) != 2 {
+		t.Errorf("unexpected record: %#v", record)
+	}
+	if expected := `{"linked":["e/f3","f/f3"]}`; lines[2] != expected {
+		t.Errorf("got %s; expected %s", lines[2], expected)
+	}
+}
+
+func Test_writeGroups_csv(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeGroups(&buf, "csv", testGroups, testLinks); err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Count(buf.String(), "\n"); lines != 8 {
+		t.Errorf("got %d lines; expected header, 6 paths and one embedded newline:\n%s", lines, buf.String())
+	}
+	if !strings.HasPrefix(buf.String(), "group,size,hash,probable,path,") {
+		t.Errorf("unexpected header:\n%s", buf.String())
+	}
+	if !strings.HasSuffix(buf.String(), "3,,,,f/f3,,,,,,linked\n") {
+		t.Errorf("unexpected links:\n%s", buf.String())
+	}
+}
+
+func Test_writeGroups_null(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeGroups(&buf, "null", testGroups, testLinks); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "a/f1\000b/f1\000\000c/with\nnewline\000d/f2\000\000"
+	if actual := buf.String(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("got %q; expected %q", actual, expected)
+	}
+}
+
+func Test_writeGroups_text_headers(t *testing.T) {
+	groups := []dupfinder.Group{
+		{Paths: []string{"archive/f1", "archive/f2", "incoming/f1"}, Infos: make([]os.FileInfo, 3), References: []bool{true, true, false}, Size: 3},
+		{Paths: []string{"incoming/g1", "incoming/g2"}, Infos: make([]os.FileInfo, 2), References: []bool{false, false}, Size: 5, Digest: "abc", Algorithm: "sha256"},
+		{Paths: []string{"incoming/h1", "incoming/h2"}, Infos: make([]os.FileInfo, 2), References: []bool{false, false}, Size: 7, Probable: true},
+	}
+
+	var buf bytes.Buffer
+	if err := writeGroups(&buf, "text", groups, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "# copies of: archive/f1\nincoming/f1\n\n" +
+		"# file sizes: 5 sha256: abc\nincoming/g1\nincoming/g2\n\n" +
+		"# file sizes: 7 (probable duplicates, not verified)\nincoming/h1\nincoming/h2\n\n"
+	if actual := buf.String(); actual != expected {
+		t.Errorf("got %q; expected %q", actual, expected)
+	}
+}
+
+func Test_writeLinks(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeLinks(&buf, [][]string{{"a/f1", "b/f1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "# already linked: 2 paths\na/f1\nb/f1\n\n"
+	if actual := buf.String(); actual != expected {
+		t.Errorf("got %q; expected %q", actual, expected)
+	}
+}
+
+func Test_writePaths(t *testing.T) {
+	paths := []string{"a/f1", "b/with\nnewline"}
+	for _, test := range []struct {
+		format   string
+		expected string
+	}{
+		{"text", "a/f1\nb/with\nnewline\n"},
+		{"null", "a/f1\000b/with\nnewline\000"},
+		{"ndjson", "\"a/f1\"\n\"b/with\\nnewline\"\n"},
+		{"csv", "path\na/f1\n\"b/with\nnewline\"\n"},
+	} {
+		var buf bytes.Buffer
+		if err := writePaths(&buf, test.format, paths); err != nil {
+			t.Fatal(err)
+		}
+		if actual := buf.String(); actual != test.expected {
+			t.Errorf("%s: got %q; expected %q", test.format, actual, test.expected)
+		}
+	}
+}
@@ -10,64 +10,355 @@ import (
 	"strconv"
 	"github.com/janosgyerik/dupfinder/utils"
 	"path/filepath"
+	"errors"
+	"regexp"
+	"sync"
+	"runtime"
+	"strings"
+	"github.com/janosgyerik/dupfinder/cache"
+	"github.com/janosgyerik/dupfinder/checkpoint"
+	"github.com/janosgyerik/dupfinder/similar"
+	"time"
+	"context"
+	"os/signal"
+	"syscall"
 )
 
 var verbose bool
 
 const defaultExclude = `^\.(DS_Store|git)$`
 
-func exit() {
-	flag.Usage()
+const defaultExcludeDir = `^\.git$`
+
+func exit(flags *flag.FlagSet) {
+	flags.Usage()
 	os.Exit(1)
 }
 
+func exitWithError(flags *flag.FlagSet, err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	exit(flags)
+}
+
+type skippedPath struct {
+	path   string
+	reason error
+}
+
+// skipList collects the paths that could not be processed, with the reason
+type skipList struct {
+	mutex sync.Mutex
+	items []skippedPath
+}
+
+func (s *skipList) add(path string, reason error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.items = append(s.items, skippedPath{path, reason})
+}
+
+func (s *skipList) addError(err error) {
+	var pathError *os.PathError
+	if errors.As(err, &pathError) {
+		s.add(pathError.Path, pathError.Err)
+	} else {
+		s.add("", err)
+	}
+}
+
+func (s *skipList) print() {
+	if len(s.items) == 0 {
+		return
+	}
+	fmt.Fprintln(os.Stderr, "Skipped paths:", len(s.items))
+	for _, item := range s.items {
+		fmt.Fprintf(os.Stderr, "  %s: %v\n", item.path, item.reason)
+	}
+}
+
+var skipped = &skipList{}
+
 type Params struct {
-	paths   <-chan string
-	minSize int64
-	stdin   bool
-	stdin0  bool
-	verbose bool
-	include []string
-	exclude []string
+	ctx      context.Context
+	paths    <-chan string
+	roots    []string
+	refs     []string
+	minSize  int64
+	symlinks finder.SymlinkPolicy
+	stdin    bool
+	stdin0   bool
+	verbose  bool
+	verify   bool
+	strict   bool
+	jobs     int
+	trees    bool
+	top      int
+	subtrees bool
+	unique   bool
+	missing  bool
+	images   bool
+	lazy     *dupfinder.Sampling
+	hasher   dupfinder.Hasher
+	format   string
+	cache    string
+	noCache  bool
+	include  []string
+	exclude  []string
+
+	resume             string
+	checkpoint         string
+	checkpointInterval time.Duration
+
+	imageHasher similar.ImageHasher
+	maxDistance int
+	similarity  float64
 }
 
-func parseArgs() Params {
-	minSizePtr := flag.String("minSize", "100m", "minimum file size")
-	stdinPtr := flag.Bool("stdin", false, "read paths from stdin")
-	zeroPtr := flag.Bool("0", false, "read paths from stdin, null-delimited")
-	silentPtr := flag.Bool("silent", false, "silent mode, do not print stats on stderr")
-	includePtr := flag.String("include", ".", "include file paths that match regex")
-	excludePtr := flag.String("exclude", defaultExclude, "exclude file paths that match regex")
+// scanFlags are the flags of all commands that scan for duplicates
+type scanFlags struct {
+	minSize       *string
+	stdin         *bool
+	zero          *bool
+	silent        *bool
+	include       *string
+	exclude       *string
+	excludeDir    *string
+	maxDepth      *int
+	oneFileSystem *bool
+	symlinks      *string
+	ignoreFile    *string
+	verify        *bool
+	jobs          *int
+	cache         *string
+	noCache       *bool
+	checkpoint    *string
+	interval      *time.Duration
+	resume        *string
+	hash          *string
+	lazy          *bool
+	lazyHead      *int
+	lazyTail      *int
+	lazyBlocks    *int
+	strict        *bool
+	files         *fileFlags
+	refs          stringList
+}
+
+func addScanFlags(flags *flag.FlagSet) *scanFlags {
+	f := &scanFlags{
+		minSize:       flags.String("minSize", "100m", "minimum file size"),
+		stdin:         flags.Bool("stdin", false, "read paths from stdin"),
+		zero:          flags.Bool("0", false, "read paths from stdin, null-delimited"),
+		silent:        flags.Bool("silent", false, "silent mode, do not print stats on stderr"),
+		include:       flags.String("include", ".", "include file paths that match regex"),
+		exclude:       flags.String("exclude", defaultExclude, "exclude file paths that match regex"),
+		excludeDir:    flags.String("exclude-dir", defaultExcludeDir, "do not descend into directories whose name matches regex"),
+		maxDepth:      flags.Int("max-depth", -1, "descend at most this many directory levels below the specified paths (-1 for unlimited)"),
+		oneFileSystem: flags.Bool("one-file-system", false, "do not descend into directories on other file systems"),
+		symlinks:      flags.String("follow-symlinks", "never", "which symbolic links to follow: never, files (links to files), all (also descend into linked directories)"),
+		ignoreFile:    flags.String("ignore-file", "", "ignore paths matching the patterns of this file in gitignore syntax, besides "+finder.IgnoreFileName+" files"),
+		verify:        flags.Bool("verify", false, "compare files byte by byte after matching their hashes"),
+		jobs:          flags.Int("jobs", runtime.NumCPU(), "number of files to read in parallel"),
+		cache:         flags.String("cache", "", "path of the hash cache file (default under the user cache directory)"),
+		noCache:       flags.Bool("no-cache", false, "do not read or write the hash cache"),
+		checkpoint:    flags.String("checkpoint", "", "save the progress of the scan to this file periodically, to continue later with -resume"),
+		interval:      flags.Duration("checkpoint-interval", time.Minute, "with -checkpoint, how often to save"),
+		resume:        flags.String("resume", "", "continue a scan from this checkpoint file, not reading again files unchanged since; implies -checkpoint with the same file"),
+		hash:          flags.String("hash", dupfinder.Hashers.SHA256.Name(), "hash algorithm to compare files with: "+strings.Join(dupfinder.HasherNames, ", ")),
+		lazy:          flags.Bool("lazy", false, "compare only samples of files, reporting probable duplicates (use -verify to confirm them)"),
+		lazyHead:      flags.Int("lazy-head", 10, "with -lazy, percentage to compare at the start of files"),
+		lazyTail:      flags.Int("lazy-tail", 10, "with -lazy, percentage to compare at the end of files"),
+		lazyBlocks:    flags.Int("lazy-blocks", 8, "with -lazy, number of evenly spaced blocks to compare in between"),
+		strict:        flags.Bool("strict", false, "exit with non-zero status if any path was skipped because of errors"),
+		files:         addFileFlags(flags),
+	}
+	flags.Var(&f.refs, "ref", "also scan this reference directory, to find copies of its files without reporting duplicates among them; may be repeated")
+	return f
+}
+
+// params validates the parsed flags, and sets up the source of paths to scan
+func (f *scanFlags) params(flags *flag.FlagSet) Params {
+	minSize, err := toByteCount(*f.minSize)
+	if err != nil {
+		exitWithError(flags, err)
+	}
+	for _, pattern := range []string{*f.include, *f.exclude, *f.excludeDir} {
+		if _, err := regexp.Compile(pattern); err != nil {
+			exitWithError(flags, err)
+		}
+	}
+
+	symlinks, err := finder.ParseSymlinkPolicy(*f.symlinks)
+	if err != nil {
+		exitWithError(flags, err)
+	}
+
+	fileFilters := f.files.filters(flags, time.Now())
 
-	flag.Parse()
+	hasher, ok := dupfinder.HasherByName(*f.hash)
+	if !ok {
+		exitWithError(flags, fmt.Errorf("invalid hash: %q", *f.hash))
+	}
 
-	minSize := toByteCount(*minSizePtr)
+	var lazy *dupfinder.Sampling
+	if *f.lazy {
+		lazy = &dupfinder.Sampling{HeadPercent: *f.lazyHead, TailPercent: *f.lazyTail, Blocks: *f.lazyBlocks}
+	}
+
+	// reference directories are scanned first
+	roots := append(append([]string(nil), f.refs...), flags.Args()...)
+
+	ctx := interruptContext()
 
 	var paths <-chan string
-	if *zeroPtr {
+	if *f.zero {
 		paths = pathreader.FromNullDelimited(os.Stdin)
-	} else if *stdinPtr {
+	} else if *f.stdin {
 		paths = pathreader.FromLines(os.Stdin)
-	} else if len(flag.Args()) > 0 {
+	} else if len(flags.Args()) > 0 {
 		filters := []finder.Filter{
 			finder.Filters.MinSize(minSize),
-			finder.Filters.IncludeRegex(*includePtr),
-			finder.Filters.ExcludeRegex(*excludePtr),
+			finder.Filters.IncludeRegex(*f.include),
+			finder.Filters.ExcludeRegex(*f.exclude),
+			finder.Filters.ExcludeDirRegex(*f.excludeDir),
+		}
+		if *f.maxDepth >= 0 {
+			filters = append(filters, finder.Filters.MaxDepth(*f.maxDepth))
+		}
+		if *f.oneFileSystem {
+			filters = append(filters, finder.Filters.OneFileSystem)
 		}
+		filters = append(filters, fileFilters...)
 		filefinder := finder.NewFinder(filters...)
-		paths = findInAll(filefinder, flag.Args())
+		filefinder.SetErrorHandler(skipped.add)
+		filefinder.SetSymlinkPolicy(symlinks)
+		if *f.ignoreFile != "" {
+			if err := filefinder.SetIgnoreFile(*f.ignoreFile); err != nil {
+				exitWithError(flags, err)
+			}
+		}
+		paths = findInAll(ctx, filefinder, roots)
 	} else {
-		exit()
+		exit(flags)
+	}
+
+	checkpointPath := *f.checkpoint
+	if checkpointPath == "" {
+		checkpointPath = *f.resume
 	}
 
 	return Params{
-		paths:   paths,
-		minSize: minSize,
-		verbose: !*silentPtr,
+		ctx:                ctx,
+		paths:              paths,
+		roots:              roots,
+		refs:               f.refs,
+		minSize:            minSize,
+		symlinks:           symlinks,
+		stdin:              *f.stdin,
+		stdin0:             *f.zero,
+		verbose:            !*f.silent,
+		verify:             *f.verify,
+		strict:             *f.strict,
+		jobs:               *f.jobs,
+		lazy:               lazy,
+		hasher:             hasher,
+		cache:              *f.cache,
+		noCache:            *f.noCache,
+		resume:             *f.resume,
+		checkpoint:         checkpointPath,
+		checkpointInterval: *f.interval,
+	}
+}
+
+func parseArgs() Params {
+	flags := flag.CommandLine
+	scan := addScanFlags(flags)
+	treesPtr := flags.Bool("trees", false, "find identical directory trees instead of files (-minSize defaults to 0)")
+	subtreesPtr := flags.Bool("subtrees", false, "with -trees, also find directory trees that contain all files of another")
+	formatPtr := flags.String("format", "text", "output format: "+strings.Join(formats, ", "))
+	print0Ptr := flags.Bool("print0", false, "print paths null-delimited, with an extra null after each group; same as -format null")
+	topPtr := flags.Int("top", 10, "in the summary, list the N groups with the most reclaimable space")
+	uniquePtr := flags.Bool("unique", false, "list files that have no duplicate instead (-minSize defaults to 0)")
+	missingFromPtr := flags.String("missing-from", "", "list files that have no copy in this directory instead, such as a backup (-minSize defaults to 0)")
+	imagesPtr := flags.Bool("similar-images", false, "find similar JPEG, PNG and GIF images by perceptual hash instead, such as resized or re-encoded copies (-minSize defaults to 1)")
+	imageHashPtr := flags.String("image-hash", similar.ImageHashers.Perception.Name(), "with -similar-images, perceptual hash algorithm: "+strings.Join(similar.ImageHasherNames, ", "))
+	similarityPtr := flags.Float64("similarity", 0, "find files whose content is at least this similar instead, between 0 and 1, such as 0.9 for files that differ in a tenth of their content (-minSize defaults to 1)")
+	maxDistancePtr := flags.Int("max-distance", 8, "with -similar-images, maximum number of differing bits of the 64-bit hashes of similar images")
+
+	flags.Parse(os.Args[1:])
+
+	if !isFlagSet(flags, "minSize") {
+		if *treesPtr || *uniquePtr || *missingFromPtr != "" {
+			*scan.minSize = "0"
+		} else if *imagesPtr || *similarityPtr != 0 {
+			*scan.minSize = "1"
+		}
+	}
+	if *missingFromPtr != "" {
+		scan.refs = append(scan.refs, *missingFromPtr)
+	}
+
+	if *print0Ptr {
+		*formatPtr = "null"
 	}
+	if !isValidFormat(*formatPtr) {
+		exitWithError(flags, fmt.Errorf("invalid format: %q", *formatPtr))
+	}
+	if *treesPtr && *formatPtr != "text" {
+		exitWithError(flags, errors.New("-trees supports only the text format"))
+	}
+	modes := 0
+	for _, set := range []bool{*treesPtr, *uniquePtr, *missingFromPtr != "", *imagesPtr, *similarityPtr != 0} {
+		if set {
+			modes++
+		}
+	}
+	if modes > 1 {
+		exitWithError(flags, errors.New("-trees, -unique, -missing-from, -similar-images and -similarity are mutually exclusive"))
+	}
+	if *similarityPtr < 0 || *similarityPtr > 1 {
+		exitWithError(flags, fmt.Errorf("invalid similarity: %v", *similarityPtr))
+	}
+	imageHasher, ok := similar.ImageHasherByName(*imageHashPtr)
+	if !ok {
+		exitWithError(flags, fmt.Errorf("invalid image hash: %q", *imageHashPtr))
+	}
+	if *maxDistancePtr < 0 || *maxDistancePtr > 64 {
+		exitWithError(flags, fmt.Errorf("invalid max distance: %d", *maxDistancePtr))
+	}
+
+	params := scan.params(flags)
+	params.trees = *treesPtr
+	params.subtrees = *subtreesPtr
+	params.unique = *uniquePtr
+	params.missing = *missingFromPtr != ""
+	params.images = *imagesPtr
+	params.imageHasher = imageHasher
+	params.maxDistance = *maxDistancePtr
+	params.similarity = *similarityPtr
+	if params.images {
+		params.paths = filterPaths(params.paths, similar.IsImage)
+	}
+	params.format = *formatPtr
+	params.top = *topPtr
+	return params
+}
+
+func isFlagSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
 
-func toByteCount(s string) int64 {
+func toByteCount(s string) (int64, error) {
+	if s == "" {
+		return 0, errors.New("invalid size: empty string")
+	}
+
 	numPart := s[0 : len(s)-1]
 	unitPart := s[len(s)-1]
 
@@ -97,19 +388,25 @@ func toByteCount(s string) int64 {
 	}
 
 	v, err := strconv.Atoi(numPart)
-	utils.PanicIfFailed(err)
-	return int64(v) * multiplier
+	if err != nil {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	return int64(v) * multiplier, nil
 }
 
-func findInAll(f finder.Finder, args []string) <-chan string {
+func findInAll(ctx context.Context, f finder.Finder, args []string) <-chan string {
 	agg := make(chan string)
 	go func() {
+		defer close(agg)
 		for _, path := range args {
-			for msg := range f.Find(path) {
-				agg <- msg
+			for msg := range f.FindContext(ctx, path) {
+				select {
+				case agg <- msg:
+				case <-ctx.Done():
+					return
+				}
 			}
 		}
-		close(agg)
 	}()
 
 	return agg
@@ -130,24 +427,44 @@ func status(first string, args ...interface{}) {
 }
 
 type eventListener struct {
-	bytesRead int64
+	*dupfinder.Progress
 }
 
-func (log *eventListener) NewDuplicate(paths []string) {
+func (log *eventListener) GroupCreated(event dupfinder.GroupEvent) {
 	printLine()
-	for _, path := range paths {
+	printLine("# new group", event.ID)
+	for _, path := range event.Paths {
 		printLine(path)
 	}
 	printLine()
 }
 
-func (log *eventListener) BytesRead(count int) {
-	log.bytesRead += int64(count)
+func (log *eventListener) GroupGrew(event dupfinder.GroupEvent) {
+	printLine("# group", event.ID, "grew:", event.Path)
 }
 
-func main() {
-	params := parseArgs()
+func printTrees(tracker dupfinder.Tracker, subtrees bool) {
+	for _, group := range tracker.DupTrees() {
+		fmt.Println("# tree sizes:", group.Size, "files:", group.Files)
+		for _, path := range group.Paths {
+			fmt.Println(path)
+		}
+		fmt.Println()
+	}
+
+	if !subtrees {
+		return
+	}
+	for _, subTree := range tracker.SubTrees() {
+		fmt.Println("# superset, subset")
+		fmt.Println(subTree.Super)
+		fmt.Println(subTree.Sub)
+		fmt.Println()
+	}
+}
 
+// scanPaths collects the paths to check and adds them to a new tracker
+func scanPaths(params Params) dupfinder.Tracker {
 	verbose = params.verbose
 
 	printLine("Collecting paths to check ...")
@@ -155,8 +472,8 @@ func main() {
 	uniq := utils.NewUniqueFilter()
 	var paths []string
 	i := 1
-	for path := range params.paths {
-		if !utils.IsFile(path) {
+	for path := range pathsUntilDone(params.ctx, params.paths) {
+		if !finder.IsFile(path, params.symlinks) {
 			continue
 		}
 
@@ -172,26 +489,174 @@ func main() {
 	}
 	printLine()
 
-	tracker := dupfinder.NewTracker()
-	eventListener := eventListener{}
-	tracker.SetEventListener(&eventListener)
+	options := []dupfinder.Option{dupfinder.Options.Jobs(params.jobs)}
+	if params.verify {
+		options = append(options, dupfinder.Options.Verify)
+	}
+	if params.lazy != nil {
+		options = append(options, dupfinder.Options.Lazy(*params.lazy))
+	}
+	options = append(options, dupfinder.Options.Hash(params.hasher))
+	if len(params.refs) > 0 {
+		options = append(options, dupfinder.Options.Reference(params.refs...))
+	}
+	if !params.stdin && !params.stdin0 && len(params.roots) > 0 {
+		// only the scanned directories are compared as trees, not their parents
+		options = append(options, dupfinder.Options.Roots(params.roots...))
+	}
+	if params.resume != "" {
+		snapshot, err := checkpoint.Load(params.resume)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error: cannot resume:", err)
+			os.Exit(1)
+		}
+		printLine("Resuming from", len(snapshot.Files), "files processed before")
+		options = append(options, dupfinder.Options.Resume(snapshot))
+	}
 
-	i = 1
-	for _, path := range paths {
-		tracker.Add(path)
-		status("Processing: %d / %d", i, len(paths))
-		i += 1
+	var hashCache cache.Cache
+	if !params.noCache {
+		c, err := openCache(params.cache)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "warning: not using hash cache:", err)
+		} else {
+			hashCache = c
+			options = append(options, dupfinder.Options.Cache(hashCache))
+		}
 	}
-	printLine()
 
-	for _, group := range tracker.Dups() {
-		fmt.Println("# file sizes:", utils.FileSize(group[0]))
-		for _, path := range group {
-			fmt.Println(path)
+	tracker := dupfinder.NewTracker(options...)
+	eventListener := eventListener{dupfinder.NewProgress()}
+	tracker.SetEventListener(&eventListener)
+
+	printLine("Processing", len(paths), "files ...")
+
+	var reporter *progressReporter
+	if verbose {
+		reporter = startProgress(eventListener.Progress, os.Stderr, isTerminal(os.Stderr))
+	}
+	var errs []error
+	if params.checkpoint != "" {
+		errs = addWithCheckpoints(params.ctx, tracker, paths, params.checkpoint, params.checkpointInterval)
+	} else {
+		errs = tracker.AddAllContext(params.ctx, channelOf(paths))
+	}
+	if reporter != nil {
+		reporter.stop()
+	}
+	for _, err := range errs {
+		if err == params.ctx.Err() {
+			fmt.Fprintln(os.Stderr, "Interrupted, the results are partial")
+			continue
 		}
-		fmt.Println()
+		skipped.addError(err)
 	}
 
-	printLine("Total bytes read:", eventListener.bytesRead)
+	printLine("Total bytes read:", eventListener.Stats().BytesRead)
 	printLine("Total files processed:", len(paths))
+
+	if hashCache != nil {
+		if err := hashCache.Save(); err != nil {
+			fmt.Fprintln(os.Stderr, "warning: could not save hash cache:", err)
+		}
+	}
+
+	return tracker
+}
+
+// finish prints the skipped paths, and exits with non-zero status
+// if there were any and that was requested
+func finish(params Params) {
+	skipped.print()
+	if params.ctx != nil && params.ctx.Err() != nil {
+		os.Exit(130)
+	}
+	if params.strict && len(skipped.items) > 0 {
+		os.Exit(1)
+	}
+}
+
+// interruptContext returns a context that is done on the first interrupt
+// or termination signal. Further signals terminate the program as usual.
+func interruptContext() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx
+}
+
+// pathsUntilDone forwards the paths until the channel is closed
+// or the context is done, whichever comes first
+func pathsUntilDone(ctx context.Context, paths <-chan string) <-chan string {
+	out := make(chan string)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case path, ok := <-paths:
+				if !ok {
+					return
+				}
+				select {
+				case out <- path:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "cache":
+			cacheCommand(os.Args[2:])
+			return
+		case "act":
+			actCommand(os.Args[2:])
+			return
+		case "undo":
+			undoCommand(os.Args[2:])
+			return
+		case "diff":
+			diffCommand(os.Args[2:])
+			return
+		}
+	}
+
+	params := parseArgs()
+	tracker := scanPaths(params)
+
+	if params.trees {
+		printTrees(tracker, params.subtrees)
+	} else if params.images {
+		printSimilarImages(params, tracker)
+	} else if params.similarity != 0 {
+		printSimilarTexts(params, tracker)
+	} else if params.unique || params.missing {
+		paths := tracker.Uniques()
+		if params.missing {
+			paths = tracker.Missing()
+		}
+		if err := writePaths(os.Stdout, params.format, paths); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+	} else {
+		if err := writeGroups(os.Stdout, params.format, tracker.Groups(), tracker.Links()); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		if verbose {
+			writeSummary(os.Stderr, tracker.Report(), params.top)
+		}
+	}
+
+	finish(params)
 }
@@ -77,6 +77,59 @@ func Test_find_multiple_varied_sized_groups(t *testing.T) {
 	}
 }
 
+func Test_find_trees(t *testing.T) {
+	fdata := []fileData{
+		{"a/x/f1.txt", "foo"},
+		{"a/x/f2.txt", "bar"},
+		{"b/x/f1.txt", "foo"},
+		{"b/x/f2.txt", "bar"},
+		{"c/f1.txt", "foo"},
+	}
+	expected := [][]string{{"a", "b"}}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	if actual := normalize(run("-trees")); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("got:\n%#v\nexpected:\n%#v", actual, expected)
+	}
+}
+
+func Test_find_trees_compares_empty_files(t *testing.T) {
+	fdata := []fileData{
+		{"a/f1.txt", "foo"},
+		{"a/empty", ""},
+		{"b/f1.txt", "foo"},
+		{"c/f1.txt", "foo"},
+		{"c/empty", ""},
+	}
+	expected := [][]string{{"a", "c"}}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	if actual := normalize(runWithDefaults("-silent", "-trees")); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("got:\n%#v\nexpected:\n%#v", actual, expected)
+	}
+}
+
+func Test_missing_from_lists_empty_files(t *testing.T) {
+	fdata := []fileData{
+		{"backup/a", "apple"},
+		{"src/a", "apple"},
+		{"src/empty-config", ""},
+	}
+	expected := [][]string{{"src/empty-config"}}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	actual := normalize(runWithDefaults("-silent", "-missing-from", path.Join(tempdir, "backup")))
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("got:\n%#v\nexpected:\n%#v", actual, expected)
+	}
+}
+
 func normalize(out string) [][]string {
 	var result [][]string
 	var current []string
@@ -113,8 +166,14 @@ func deleteTempFiles() {
 	utils.PanicIfFailed(err)
 }
 
-func run() string {
-	out, err := exec.Command("go", "run", "main.go", "-minSize", "1", tempdir).Output()
+func run(args ...string) string {
+	return runWithDefaults(append([]string{"-minSize", "1"}, args...)...)
+}
+
+// runWithDefaults runs the command without overriding the default -minSize
+func runWithDefaults(args ...string) string {
+	args = append([]string{"run", ".", "-no-cache"}, args...)
+	out, err := exec.Command("go", append(args, tempdir)...).Output()
 	utils.PanicIfFailed(err)
 	return string(out)
 }
@@ -138,8 +197,20 @@ func Test_toByteCount(t *testing.T) {
 		{"1T", 1024 * 1024 * 1024 * 1024},
 	}
 	for _, x := range data {
-		if v := toByteCount(x.input); v != x.count {
+		v, err := toByteCount(x.input)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %v", x.input, err)
+		}
+		if v != x.count {
 			t.Errorf("got %d; expected %d", v, x.count)
 		}
 	}
 }
+
+func Test_toByteCount_invalid(t *testing.T) {
+	for _, input := range []string{"", "k", "1x", "foo", "1.5m"} {
+		if _, err := toByteCount(input); err == nil {
+			t.Errorf("expected error for %q", input)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/janosgyerik/dupfinder"
+)
+
+// progressReporter renders the progress of a scan until stopped:
+// on terminals as a single line updated in place, otherwise as periodic log lines
+type progressReporter struct {
+	progress *dupfinder.Progress
+	w        io.Writer
+	tty      bool
+	stopped  chan struct{}
+	wg       sync.WaitGroup
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func startProgress(progress *dupfinder.Progress, w io.Writer, tty bool) *progressReporter {
+	r := &progressReporter{progress: progress, w: w, tty: tty, stopped: make(chan struct{})}
+	interval := 10 * time.Second
+	if tty {
+		interval = 200 * time.Millisecond
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.render()
+			case <-r.stopped:
+				if r.tty {
+					fmt.Fprint(r.w, "\r\033[K")
+				}
+				return
+			}
+		}
+	}()
+	return r
+}
+
+func (r *progressReporter) render() {
+	line := formatProgress(r.progress.Stats())
+	if r.tty {
+		fmt.Fprint(r.w, "\r\033[K"+line)
+	} else {
+		fmt.Fprintln(r.w, line)
+	}
+}
+
+func (r *progressReporter) stop() {
+	close(r.stopped)
+	r.wg.Wait()
+}
+
+// formatDuration formats a duration as h:mm:ss or m:ss
+func formatDuration(d time.Duration) string {
+	seconds := int64(d.Round(time.Second) / time.Second)
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+func formatProgress(stats dupfinder.ProgressStats) string {
+	parts := []string{stats.Phase.String()}
+	if stats.TotalBytes > 0 {
+		parts = append(parts, fmt.Sprintf("%s / %s (%d%%)",
+			formatBytes(stats.Bytes), formatBytes(stats.TotalBytes), stats.Bytes*100/stats.TotalBytes))
+	}
+	if stats.TotalFiles > 0 {
+		parts = append(parts, fmt.Sprintf("%d / %d files", stats.Files, stats.TotalFiles))
+	}
+	parts = append(parts,
+		fmt.Sprintf("%s/s", formatBytes(int64(stats.BytesPerSecond))),
+		fmt.Sprintf("%.1f files/s", stats.FilesPerSecond))
+	if stats.ETA >= 0 {
+		parts = append(parts, "ETA "+formatDuration(stats.ETA))
+	}
+	if stats.Current != "" {
+		parts = append(parts, stats.Current)
+	}
+	return strings.Join(parts, ", ")
+}
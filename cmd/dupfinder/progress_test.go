@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/janosgyerik/dupfinder"
+)
+
+func Test_formatDuration(t *testing.T) {
+	data := []struct {
+		d        time.Duration
+		expected string
+	}{
+		{0, "0:00"},
+		{59 * time.Second, "0:59"},
+		{61 * time.Second, "1:01"},
+		{3*time.Hour + 2*time.Minute + 1*time.Second, "3:02:01"},
+	}
+	for _, item := range data {
+		if actual := formatDuration(item.d); actual != item.expected {
+			t.Errorf("formatDuration(%v) = %q; expected %q", item.d, actual, item.expected)
+		}
+	}
+}
+
+func Test_formatProgress(t *testing.T) {
+	stats := dupfinder.ProgressStats{
+		Phase:          dupfinder.PhaseFullDigest,
+		Files:          3,
+		TotalFiles:     10,
+		Bytes:          1 << 20,
+		TotalBytes:     4 << 20,
+		BytesPerSecond: 1 << 19,
+		FilesPerSecond: 1.5,
+		ETA:            6 * time.Second,
+		Current:        "a/b",
+	}
+	expected := "full-digest, 1.0 MiB / 4.0 MiB (25%), 3 / 10 files, 512.0 KiB/s, 1.5 files/s, ETA 0:06, a/b"
+	if actual := formatProgress(stats); actual != expected {
+		t.Errorf("got %q; expected %q", actual, expected)
+	}
+
+	stats = dupfinder.ProgressStats{Phase: dupfinder.PhaseGrouping, ETA: -1}
+	expected = "grouping, 0 B/s, 0.0 files/s"
+	if actual := formatProgress(stats); actual != expected {
+		t.Errorf("got %q; expected %q", actual, expected)
+	}
+}
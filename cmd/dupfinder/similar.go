@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/janosgyerik/dupfinder"
+	"github.com/janosgyerik/dupfinder/similar"
+)
+
+// filterPaths forwards the paths accepted by the function
+func filterPaths(paths <-chan string, accept func(path string) bool) <-chan string {
+	out := make(chan string)
+	go func() {
+		defer close(out)
+		for path := range paths {
+			if accept(path) {
+				out <- path
+			}
+		}
+	}()
+	return out
+}
+
+type imageRecord struct {
+	Path     string `json:"path"`
+	Hash     string `json:"hash"`
+	Distance int    `json:"distance"`
+}
+
+type imageGroupRecord struct {
+	Algorithm string        `json:"algorithm"`
+	Files     []imageRecord `json:"files"`
+}
+
+func newImageGroupRecord(algorithm string, group similar.ImageGroup) imageGroupRecord {
+	record := imageGroupRecord{Algorithm: algorithm}
+	for i, path := range group.Paths {
+		record.Files = append(record.Files, imageRecord{path, group.Hashes[i].String(), group.Distances[i]})
+	}
+	return record
+}
+
+// writeImageGroups writes the groups of similar images in the specified format
+func writeImageGroups(w io.Writer, format, algorithm string, groups []similar.ImageGroup) error {
+	switch format {
+	case "json":
+		records := make([]imageGroupRecord, 0)
+		for _, group := range groups {
+			records = append(records, newImageGroupRecord(algorithm, group))
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+
+	case "ndjson":
+		encoder := json.NewEncoder(w)
+		for _, group := range groups {
+			if err := encoder.Encode(newImageGroupRecord(algorithm, group)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"group", "path", "hash", "distance", "algorithm"})
+		for i, group := range groups {
+			for j, path := range group.Paths {
+				writer.Write([]string{
+					strconv.Itoa(i + 1),
+					path,
+					group.Hashes[j].String(),
+					strconv.Itoa(group.Distances[j]),
+					algorithm,
+				})
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+
+	case "null":
+		for _, group := range groups {
+			for _, path := range group.Paths {
+				if _, err := fmt.Fprintf(w, "%s\000", path); err != nil {
+					return err
+				}
+			}
+			if _, err := fmt.Fprint(w, "\000"); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		for _, group := range groups {
+			fmt.Fprintln(w, "# similar images: distance up to", group.MaxDistance())
+			for _, path := range group.Paths {
+				fmt.Fprintln(w, path)
+			}
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+type pairRecord struct {
+	A          string  `json:"a"`
+	B          string  `json:"b"`
+	Similarity float64 `json:"similarity"`
+}
+
+type textGroupRecord struct {
+	Files []string     `json:"files"`
+	Pairs []pairRecord `json:"pairs"`
+}
+
+func newTextGroupRecord(group similar.TextGroup) textGroupRecord {
+	record := textGroupRecord{Files: group.Paths}
+	for _, pair := range group.Pairs {
+		record.Pairs = append(record.Pairs, pairRecord{pair.A, pair.B, pair.Similarity})
+	}
+	return record
+}
+
+// writeTextGroups writes the groups of similar files in the specified format,
+// with the similarity of each pair of files in the group
+func writeTextGroups(w io.Writer, format string, groups []similar.TextGroup) error {
+	switch format {
+	case "json":
+		records := make([]textGroupRecord, 0)
+		for _, group := range groups {
+			records = append(records, newTextGroupRecord(group))
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+
+	case "ndjson":
+		encoder := json.NewEncoder(w)
+		for _, group := range groups {
+			if err := encoder.Encode(newTextGroupRecord(group)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"group", "a", "b", "similarity"})
+		for i, group := range groups {
+			for _, pair := range group.Pairs {
+				writer.Write([]string{
+					strconv.Itoa(i + 1),
+					pair.A,
+					pair.B,
+					strconv.FormatFloat(pair.Similarity, 'f', -1, 64),
+				})
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+
+	case "null":
+		for _, group := range groups {
+			for _, path := range group.Paths {
+				if _, err := fmt.Fprintf(w, "%s\000", path); err != nil {
+					return err
+				}
+			}
+			if _, err := fmt.Fprint(w, "\000"); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		// the paths, then a comment line per pair
+		for _, group := range groups {
+			fmt.Fprintf(w, "# similar files: similarity at least %.2f\n", group.MinSimilarity())
+			for _, path := range group.Paths {
+				fmt.Fprintln(w, path)
+			}
+			for _, pair := range group.Pairs {
+				fmt.Fprintf(w, "# %.2f\t%s\t%s\n", pair.Similarity, pair.A, pair.B)
+			}
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// printSimilarImages groups the images scanned by the tracker
+// by perceptual hash, and writes the groups of similar images
+func printSimilarImages(params Params, tracker dupfinder.Tracker) {
+	contents := tracker.Contents()
+	printLine("Comparing", len(contents), "distinct images ...")
+
+	groups, errs := similar.GroupImages(params.ctx, contents, params.imageHasher, params.maxDistance, params.jobs)
+	reportSimilarErrors(params, errs)
+
+	if err := writeImageGroups(os.Stdout, params.format, params.imageHasher.Name(), groups); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// printSimilarTexts groups the files scanned by the tracker
+// by MinHash signature, and writes the groups of similar files
+func printSimilarTexts(params Params, tracker dupfinder.Tracker) {
+	contents := tracker.Contents()
+	printLine("Comparing", len(contents), "distinct files ...")
+
+	groups, errs := similar.GroupTexts(params.ctx, contents, params.similarity, params.jobs)
+	reportSimilarErrors(params, errs)
+
+	if err := writeTextGroups(os.Stdout, params.format, groups); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// reportSimilarErrors adds the files that could not be compared
+// to the skipped paths
+func reportSimilarErrors(params Params, errs []error) {
+	for _, err := range errs {
+		if err == params.ctx.Err() {
+			fmt.Fprintln(os.Stderr, "Interrupted, the results are partial")
+			continue
+		}
+		skipped.addError(err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/janosgyerik/dupfinder/similar"
+)
+
+var testImageGroups = []similar.ImageGroup{
+	{Paths: []string{"a.jpg", "b.png"}, Hashes: []similar.ImageHash{0xf0, 0xf1}, Distances: []int{0, 1}},
+}
+
+func Test_writeImageGroups_text(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeImageGroups(&buf, "text", "phash", testImageGroups); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "# similar images: distance up to 1\na.jpg\nb.png\n\n"
+	if actual := buf.String(); actual != expected {
+		t.Errorf("got:\n%q\nexpected:\n%q", actual, expected)
+	}
+}
+
+func Test_writeImageGroups_json(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeImageGroups(&buf, "json", "phash", testImageGroups); err != nil {
+		t.Fatal(err)
+	}
+
+	var records []imageGroupRecord
+	if err := json.Unmarshal(buf.Bytes(), &records); err != nil {
+		t.Fatal(err)
+	}
+	expected := []imageGroupRecord{{"phash", []imageRecord{{"a.jpg", "00000000000000f0", 0}, {"b.png", "00000000000000f1", 1}}}}
+	if !reflect.DeepEqual(expected, records) {
+		t.Errorf("got:\n%#v\nexpected:\n%#v", records, expected)
+	}
+}
+
+func Test_filterPaths(t *testing.T) {
+	var actual []string
+	for path := range filterPaths(channelOf([]string{"a.jpg", "b.txt", "c.PNG"}), similar.IsImage) {
+		actual = append(actual, path)
+	}
+	if expected := []string{"a.jpg", "c.PNG"}; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("got %v, expected %v", actual, expected)
+	}
+}
+
+var testTextGroups = []similar.TextGroup{
+	{Paths: []string{"a.go", "b.go"}, Pairs: []similar.Pair{{A: "a.go", B: "b.go", Similarity: 0.9375}}},
+}
+
+func Test_writeTextGroups_text(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeTextGroups(&buf, "text", testTextGroups); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "# similar files: similarity at least 0.94\na.go\nb.go\n# 0.94\ta.go\tb.go\n\n"
+	if actual := buf.String(); actual != expected {
+		t.Errorf("got:\n%q\nexpected:\n%q", actual, expected)
+	}
+}
+
+func Test_writeTextGroups_csv(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeTextGroups(&buf, "csv", testTextGroups); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "group,a,b,similarity\n1,a.go,b.go,0.9375\n"
+	if actual := buf.String(); actual != expected {
+		t.Errorf("got:\n%q\nexpected:\n%q", actual, expected)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/janosgyerik/dupfinder"
+)
+
+// formatBytes returns a byte count in human readable form, with binary units
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// writeSummary writes the totals of the report,
+// and a table of the top groups by reclaimable space
+func writeSummary(w io.Writer, report dupfinder.Report, top int) error {
+	fmt.Fprintln(w, "Duplicate groups:", len(report.Groups), "files:", report.Files)
+	fmt.Fprintln(w, "Wasted:", formatBytes(report.Wasted), "reclaimable:", formatBytes(report.Reclaimable))
+	if report.Linked > 0 {
+		fmt.Fprintln(w, "Already linked:", report.Linked, "paths, saving", formatBytes(report.LinkedBytes))
+	}
+
+	if top <= 0 || len(report.Groups) == 0 {
+		return nil
+	}
+	if top > len(report.Groups) {
+		top = len(report.Groups)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Top groups by reclaimable space:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "RECLAIMABLE\tWASTED\tCOPIES\tSIZE\t PATH")
+	for _, group := range report.Groups[:top] {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t %s\n",
+			formatBytes(group.Reclaimable), formatBytes(group.Wasted), group.Copies, formatBytes(group.Size), group.Paths[0])
+	}
+	return tw.Flush()
+}
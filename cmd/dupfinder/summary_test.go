@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/janosgyerik/dupfinder"
+)
+
+func Test_formatBytes(t *testing.T) {
+	data := []struct {
+		n        int64
+		expected string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 << 30, "5.0 GiB"},
+	}
+	for _, item := range data {
+		if actual := formatBytes(item.n); actual != item.expected {
+			t.Errorf("formatBytes(%d) = %q; expected %q", item.n, actual, item.expected)
+		}
+	}
+}
+
+func Test_writeSummary(t *testing.T) {
+	report := dupfinder.Report{
+		Groups: []dupfinder.GroupReport{
+			{Group: dupfinder.Group{Paths: []string{"a/big", "b/big"}, Size: 2048}, Copies: 2, Wasted: 2048, Reclaimable: 2048},
+			{Group: dupfinder.Group{Paths: []string{"a/small", "b/small"}, Size: 10}, Copies: 2, Wasted: 10, Reclaimable: 10},
+		},
+		Files:       4,
+		Wasted:      2058,
+		Reclaimable: 2058,
+	}
+
+	var buf bytes.Buffer
+	if err := writeSummary(&buf, report, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	output := buf.String()
+	if !strings.Contains(output, "Wasted: 2.0 KiB reclaimable: 2.0 KiB") {
+		t.Errorf("missing totals in:\n%s", output)
+	}
+	if !strings.Contains(output, "a/big") || strings.Contains(output, "a/small") {
+		t.Errorf("expected only the top group in:\n%s", output)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/janosgyerik/dupfinder/dedupe"
+)
+
+// undoCommand implements "dupfinder undo JOURNAL", that reverts the
+// operations recorded by "dupfinder act", latest first
+func undoCommand(args []string) {
+	flags := flag.NewFlagSet("undo", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: dupfinder undo JOURNAL")
+		fmt.Fprintln(os.Stderr, "Restore the files changed by dupfinder act as independent copies.")
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	entries, err := dedupe.ReadJournal(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+
+	restored := 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if err := dedupe.Undo(entry); errors.Is(err, dedupe.ErrNotApplied) {
+			continue
+		} else if err != nil {
+			skipped.addError(err)
+			continue
+		}
+		fmt.Println("restored", entry.Path)
+		restored++
+	}
+
+	fmt.Fprintln(os.Stderr, "Restored:", restored, "of", len(entries))
+	finish(Params{strict: true})
+}
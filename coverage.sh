@@ -17,8 +17,13 @@ cover() {
 }
 
 cover . . dupfinder
+cover . ./cache cache
+cover . ./checkpoint checkpoint
+cover . ./dedupe dedupe
 cover . ./finder finder
+cover . ./hashes hashes
 cover . ./pathreader pathreader
+cover . ./similar similar
 cover . ./utils utils
 cover cmd/dupfinder . cmd
 
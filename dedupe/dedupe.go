@@ -0,0 +1,326 @@
+package dedupe
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/janosgyerik/dupfinder"
+)
+
+const chunkSize = 4096
+
+// Action is what to do with the duplicates of the kept file of a group
+type Action string
+
+const (
+	Delete   Action = "delete"
+	Hardlink Action = "hardlink"
+	Symlink  Action = "symlink"
+	Reflink  Action = "reflink"
+)
+
+var Actions = []Action{Delete, Hardlink, Symlink, Reflink}
+
+func ParseAction(s string) (Action, error) {
+	for _, action := range Actions {
+		if string(action) == s {
+			return action, nil
+		}
+	}
+	return "", fmt.Errorf("invalid action: %q", s)
+}
+
+// ErrNotConfirmed is returned by Apply when the operation was done,
+// but could not be marked as done in the journal.
+// It stays recorded as pending, which Undo can revert too.
+var ErrNotConfirmed = errors.New("done, but not confirmed in the journal")
+
+// ErrContentChanged is returned by Apply when the file to replace
+// no longer has the same content as the kept file
+var ErrContentChanged = errors.New("content differs from the kept file")
+
+// KeepPolicy selects the file to keep in a group of duplicates.
+// Keep returns the index of the path to keep, or -1 to leave the group alone.
+type KeepPolicy interface {
+	Keep(group dupfinder.Group) int
+}
+
+type keepFunc func(group dupfinder.Group) int
+
+func (f keepFunc) Keep(group dupfinder.Group) int {
+	return f(group)
+}
+
+// keepBest returns the index of the path that is best according to better,
+// the first one in case of ties
+func keepBest(better func(group dupfinder.Group, i, j int) bool) KeepPolicy {
+	return keepFunc(func(group dupfinder.Group) int {
+		best := 0
+		for i := range group.Paths {
+			if better(group, i, best) {
+				best = i
+			}
+		}
+		return best
+	})
+}
+
+func rootIndex(roots []string, path string) int {
+	for i, root := range roots {
+		root = filepath.Clean(root)
+		if path == root || strings.HasPrefix(path, root+string(filepath.Separator)) {
+			return i
+		}
+	}
+	return len(roots)
+}
+
+type keepByRoots func(roots []string) KeepPolicy
+type keepByString func(s string) KeepPolicy
+
+var KeepPolicies = struct {
+	Oldest       KeepPolicy
+	Newest       KeepPolicy
+	ShortestPath KeepPolicy
+	FirstArg     keepByRoots
+	Regex        keepByString
+}{
+	Oldest: keepBest(func(group dupfinder.Group, i, j int) bool {
+		return group.Infos[i].ModTime().Before(group.Infos[j].ModTime())
+	}),
+	Newest: keepBest(func(group dupfinder.Group, i, j int) bool {
+		return group.Infos[i].ModTime().After(group.Infos[j].ModTime())
+	}),
+	ShortestPath: keepBest(func(group dupfinder.Group, i, j int) bool {
+		return len(group.Paths[i]) < len(group.Paths[j])
+	}),
+	FirstArg: func(roots []string) KeepPolicy {
+		return keepBest(func(group dupfinder.Group, i, j int) bool {
+			return rootIndex(roots, group.Paths[i]) < rootIndex(roots, group.Paths[j])
+		})
+	},
+	Regex: func(regex string) KeepPolicy {
+		re := regexp.MustCompile(regex)
+		return keepFunc(func(group dupfinder.Group) int {
+			for i, path := range group.Paths {
+				if re.MatchString(path) {
+					return i
+				}
+			}
+			return -1
+		})
+	},
+}
+
+// Operation replaces or deletes Path, a duplicate of Keep.
+// Digest is the digest of their content, computed with the hash Algorithm.
+type Operation struct {
+	Action    Action
+	Keep      string
+	Path      string
+	Digest    string
+	Algorithm string
+}
+
+func (op Operation) String() string {
+	return fmt.Sprintf("%s %s (keeping %s)", op.Action, op.Path, op.Keep)
+}
+
+// Plan returns the operations to perform on all groups,
+// acting on every file except the one selected by the policy.
+// Reference files are never acted on: in groups with reference files,
+// the policy selects the file to keep among them. Files that followed
+// symbolic links point at are not acted on either, so that they keep working.
+func Plan(groups []dupfinder.Group, action Action, policy KeepPolicy) []Operation {
+	var ops []Operation
+	for _, group := range groups {
+		keep := keepIndex(group, policy)
+		if keep < 0 {
+			continue
+		}
+		for i, path := range group.Paths {
+			// removing a file would break the symbolic links to it
+			if i != keep && !group.IsReference(i) && !group.IsSymlinked(i) {
+				ops = append(ops, Operation{Action: action, Keep: group.Paths[keep], Path: path, Digest: group.Digest, Algorithm: group.Algorithm})
+			}
+		}
+	}
+	return ops
+}
+
+// keepIndex returns the index of the file to keep selected by the policy,
+// among the reference files of the group if any
+func keepIndex(group dupfinder.Group, policy KeepPolicy) int {
+	var indexes []int
+	references := dupfinder.Group{Size: group.Size, Digest: group.Digest, Algorithm: group.Algorithm}
+	for i, path := range group.Paths {
+		if group.IsReference(i) {
+			indexes = append(indexes, i)
+			references.Paths = append(references.Paths, path)
+			references.Infos = append(references.Infos, group.Infos[i])
+			references.References = append(references.References, true)
+		}
+	}
+	if len(indexes) == 0 {
+		return policy.Keep(group)
+	}
+
+	keep := policy.Keep(references)
+	if keep < 0 {
+		return -1
+	}
+	return indexes[keep]
+}
+
+// Apply verifies that the file still has the same content as the kept file,
+// records the operation in the journal as pending, performs it,
+// and records that it was done.
+// Files are replaced atomically, by renaming a new link or clone over them.
+func Apply(op Operation, journal *Journal) error {
+	keepInfo, err := os.Stat(op.Keep)
+	if err != nil {
+		return err
+	}
+	info, err := os.Lstat(op.Path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return &os.PathError{Op: string(op.Action), Path: op.Path, Err: errors.New("not a regular file")}
+	}
+
+	if op.Action == Hardlink && os.SameFile(keepInfo, info) {
+		return nil
+	}
+
+	same, err := sameContent(op.Keep, op.Path)
+	if err != nil {
+		return err
+	}
+	if !same {
+		return &os.PathError{Op: string(op.Action), Path: op.Path, Err: ErrContentChanged}
+	}
+
+	// write-ahead, so that the change can be undone even if interrupted
+	entry, err := journal.Record(op, info)
+	if err != nil {
+		return &os.PathError{Op: "journal", Path: op.Path, Err: err}
+	}
+
+	switch op.Action {
+	case Delete:
+		err = os.Remove(op.Path)
+	case Hardlink:
+		err = replace(op, func(tmp string) error {
+			return os.Link(op.Keep, tmp)
+		})
+	case Symlink:
+		err = replace(op, func(tmp string) error {
+			target, err := filepath.Abs(op.Keep)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, tmp)
+		})
+	case Reflink:
+		err = replace(op, func(tmp string) error {
+			if err := reflink(op.Keep, tmp); err != nil {
+				return err
+			}
+			if err := os.Chmod(tmp, info.Mode().Perm()); err != nil {
+				return err
+			}
+			return os.Chtimes(tmp, info.ModTime(), info.ModTime())
+		})
+	default:
+		err = fmt.Errorf("invalid action: %q", op.Action)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := journal.Done(entry); err != nil {
+		return &os.PathError{Op: "journal", Path: op.Path, Err: fmt.Errorf("%w: %v", ErrNotConfirmed, err)}
+	}
+	return nil
+}
+
+// replace creates a temporary file next to the path of the operation,
+// and renames it over the path
+func replace(op Operation, create func(tmp string) error) error {
+	tmp, err := createTemp(op.Path, create)
+	if err != nil {
+		return &os.PathError{Op: string(op.Action), Path: op.Path, Err: err}
+	}
+	if err := os.Rename(tmp, op.Path); err != nil {
+		os.Remove(tmp)
+		return &os.PathError{Op: string(op.Action), Path: op.Path, Err: err}
+	}
+	return nil
+}
+
+// maxTempAttempts is the number of temporary names tried by createTemp
+const maxTempAttempts = 100
+
+// createTemp calls create with a random temporary path next to the path,
+// and with another one as long as it fails because the path exists.
+// On other errors, the temporary file made by create is removed.
+func createTemp(path string, create func(tmp string) error) (string, error) {
+	for i := 0; i < maxTempAttempts; i++ {
+		tmp := fmt.Sprintf("%s.%d.dupfinder-tmp", path, rand.Uint32())
+		err := create(tmp)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			os.Remove(tmp)
+			return "", err
+		}
+		return tmp, nil
+	}
+	return "", fmt.Errorf("no unused temporary name: %w", os.ErrExist)
+}
+
+func sameContent(path1, path2 string) (bool, error) {
+	f1, err := os.Open(path1)
+	if err != nil {
+		return false, err
+	}
+	defer f1.Close()
+
+	f2, err := os.Open(path2)
+	if err != nil {
+		return false, err
+	}
+	defer f2.Close()
+
+	buf1 := make([]byte, chunkSize)
+	buf2 := make([]byte, chunkSize)
+
+	for {
+		n1, err1 := io.ReadFull(f1, buf1)
+		n2, err2 := io.ReadFull(f2, buf2)
+
+		if err1 != nil && err1 != io.EOF && err1 != io.ErrUnexpectedEOF {
+			return false, err1
+		}
+		if err2 != nil && err2 != io.EOF && err2 != io.ErrUnexpectedEOF {
+			return false, err2
+		}
+
+		if !bytes.Equal(buf1[:n1], buf2[:n2]) {
+			return false, nil
+		}
+
+		if err1 != nil || err2 != nil {
+			return err1 != nil && err2 != nil, nil
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package dedupe
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/janosgyerik/dupfinder"
+	"github.com/janosgyerik/dupfinder/utils"
+)
+
+var tempdir string
+
+func createTempDir() {
+	var err error
+	tempdir, err = ioutil.TempDir("", "test")
+	utils.PanicIfFailed(err)
+}
+
+func deleteTempDir() {
+	utils.PanicIfFailed(os.RemoveAll(tempdir))
+}
+
+// writeFile creates a file with the given content and age in hours
+func writeFile(relpath, content string, age int) string {
+	path := filepath.Join(tempdir, relpath)
+	utils.PanicIfFailed(os.MkdirAll(filepath.Dir(path), 0755))
+	utils.PanicIfFailed(ioutil.WriteFile(path, []byte(content), 0644))
+	mtime := time.Now().Add(-time.Duration(age) * time.Hour)
+	utils.PanicIfFailed(os.Chtimes(path, mtime, mtime))
+	return path
+}
+
+func newGroup(paths ...string) dupfinder.Group {
+	group := dupfinder.Group{Paths: paths}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		utils.PanicIfFailed(err)
+		group.Infos = append(group.Infos, info)
+		group.Size = info.Size()
+	}
+	return group
+}
+
+func Test_KeepPolicies(t *testing.T) {
+	createTempDir()
+	defer deleteTempDir()
+
+	group := newGroup(
+		writeFile("a/long/path/f1", "foo", 3),
+		writeFile("b/f2", "foo", 1),
+		writeFile("c/f3", "foo", 5),
+	)
+
+	data := []struct {
+		name     string
+		policy   KeepPolicy
+		expected int
+	}{
+		{"oldest", KeepPolicies.Oldest, 2},
+		{"newest", KeepPolicies.Newest, 1},
+		{"shortest-path", KeepPolicies.ShortestPath, 1},
+		{"first-arg", KeepPolicies.FirstArg([]string{filepath.Join(tempdir, "c"), tempdir}), 2},
+		{"regex", KeepPolicies.Regex(`/a/`), 0},
+		{"regex without match", KeepPolicies.Regex(`/nonexistent/`), -1},
+	}
+
+	for _, item := range data {
+		if actual := item.policy.Keep(group); actual != item.expected {
+			t.Errorf("%s: got %d; expected %d", item.name, actual, item.expected)
+		}
+	}
+}
+
+func Test_Plan(t *testing.T) {
+	createTempDir()
+	defer deleteTempDir()
+
+	f1 := writeFile("f1", "foo", 2)
+	f2 := writeFile("f2", "foo", 1)
+	f3 := writeFile("f3", "foo", 3)
+	g1 := writeFile("g1", "bar", 1)
+	g2 := writeFile("g2", "bar", 2)
+
+	groups := []dupfinder.Group{newGroup(f1, f2, f3), newGroup(g1, g2)}
+	expected := []Operation{
+		{Action: Delete, Keep: f3, Path: f1},
+		{Action: Delete, Keep: f3, Path: f2},
+		{Action: Delete, Keep: g2, Path: g1},
+	}
+
+	if actual := Plan(groups, Delete, KeepPolicies.Oldest); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("got:\n%v\nexpected:\n%v", actual, expected)
+	}
+}
+
+func Test_Plan_keeps_reference_files(t *testing.T) {
+	createTempDir()
+	defer deleteTempDir()
+
+	f1 := writeFile("f1", "foo", 2)
+	f2 := writeFile("f2", "foo", 1)
+	f3 := writeFile("f3", "foo", 3)
+	f4 := writeFile("f4", "foo", 4)
+
+	group := newGroup(f1, f2, f3, f4)
+	group.References = []bool{false, true, false, true}
+	expected := []Operation{
+		{Action: Delete, Keep: f4, Path: f1},
+		{Action: Delete, Keep: f4, Path: f3},
+	}
+
+	if actual := Plan([]dupfinder.Group{group}, Delete, KeepPolicies.Oldest); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("got:\n%v\nexpected:\n%v", actual, expected)
+	}
+}
+
+func Test_Plan_keeps_symlinked_files(t *testing.T) {
+	createTempDir()
+	defer deleteTempDir()
+
+	f1 := writeFile("f1", "foo", 2)
+	f2 := writeFile("f2", "foo", 1)
+	f3 := writeFile("f3", "foo", 3)
+
+	group := newGroup(f1, f2, f3)
+	group.Symlinked = []bool{true, false, false}
+	expected := []Operation{
+		{Action: Delete, Keep: f3, Path: f2},
+	}
+
+	if actual := Plan([]dupfinder.Group{group}, Delete, KeepPolicies.Oldest); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("got:\n%v\nexpected:\n%v", actual, expected)
+	}
+}
+
+func Test_Apply(t *testing.T) {
+	createTempDir()
+	defer deleteTempDir()
+
+	journalPath := filepath.Join(tempdir, "journal", "journal.ndjson")
+	journal, err := OpenJournal(journalPath)
+	utils.PanicIfFailed(err)
+	defer journal.Close()
+
+	keep := writeFile("keep", "foo", 1)
+
+	deleted := writeFile("deleted", "foo", 1)
+	if err := Apply(Operation{Action: Delete, Keep: keep, Path: deleted, Digest: "abc", Algorithm: "sha256"}, journal); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(deleted); !os.IsNotExist(err) {
+		t.Errorf("%s still exists", deleted)
+	}
+
+	hardlinked := writeFile("hardlinked", "foo", 1)
+	if err := Apply(Operation{Action: Hardlink, Keep: keep, Path: hardlinked}, journal); err != nil {
+		t.Fatal(err)
+	}
+	keepInfo, _ := os.Stat(keep)
+	if info, _ := os.Stat(hardlinked); !os.SameFile(keepInfo, info) {
+		t.Errorf("%s is not a hard link of %s", hardlinked, keep)
+	}
+
+	symlinked := writeFile("symlinked", "foo", 1)
+	if err := Apply(Operation{Action: Symlink, Keep: keep, Path: symlinked}, journal); err != nil {
+		t.Fatal(err)
+	}
+	if target, err := os.Readlink(symlinked); err != nil || target != keep {
+		t.Errorf("got link target %q, %v; expected %s", target, err, keep)
+	}
+
+	changed := writeFile("changed", "bar", 1)
+	err = Apply(Operation{Action: Delete, Keep: keep, Path: changed}, journal)
+	if pathError, ok := err.(*os.PathError); !ok || pathError.Err != ErrContentChanged {
+		t.Errorf("got %v; expected %v", err, ErrContentChanged)
+	}
+	if _, err := os.Stat(changed); err != nil {
+		t.Errorf("%s should not have been deleted: %v", changed, err)
+	}
+
+	entries, err := ReadJournal(journalPath)
+	utils.PanicIfFailed(err)
+
+	var actual []string
+	for _, entry := range entries {
+		actual = append(actual, string(entry.Action)+" "+filepath.Base(entry.Path))
+	}
+	expected := []string{"delete deleted", "hardlink hardlinked", "symlink symlinked"}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("got journal %v; expected %v", actual, expected)
+	}
+	if entries[0].Hash != "abc" || entries[0].Algorithm != "sha256" {
+		t.Errorf("got hash %s:%s; expected sha256:abc", entries[0].Algorithm, entries[0].Hash)
+	}
+	for _, entry := range entries {
+		if entry.Status != Done {
+			t.Errorf("%s: got status %q; expected %q", entry.Path, entry.Status, Done)
+		}
+	}
+}
+
+func Test_createTemp_retries_and_keeps_existing_files(t *testing.T) {
+	createTempDir()
+	defer deleteTempDir()
+
+	keep := writeFile("keep", "foo", 1)
+	var existing string
+	tmp, err := createTemp(keep, func(tmp string) error {
+		if existing == "" {
+			// another file took the name first
+			existing = tmp
+			utils.PanicIfFailed(ioutil.WriteFile(existing, []byte("bar"), 0644))
+		}
+		return os.Link(keep, tmp)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmp == existing {
+		t.Errorf("got the existing path %s", tmp)
+	}
+	if content, err := ioutil.ReadFile(existing); err != nil || string(content) != "bar" {
+		t.Errorf("got %q, %v; expected the existing file untouched", content, err)
+	}
+
+	failed, err := createTemp(keep, func(tmp string) error {
+		utils.PanicIfFailed(ioutil.WriteFile(tmp, nil, 0644))
+		return os.ErrPermission
+	})
+	if err != os.ErrPermission {
+		t.Errorf("got %q, %v; expected %v", failed, err, os.ErrPermission)
+	}
+	if matches, _ := filepath.Glob(keep + ".*.dupfinder-tmp"); len(matches) != 2 {
+		t.Errorf("got temporary files %v; expected the failed one removed", matches)
+	}
+}
+
+func Test_Apply_keeps_files_named_like_temporary_files(t *testing.T) {
+	createTempDir()
+	defer deleteTempDir()
+
+	journal, err := OpenJournal(filepath.Join(tempdir, "journal.ndjson"))
+	utils.PanicIfFailed(err)
+	defer journal.Close()
+
+	keep := writeFile("keep", "foo", 1)
+	path := writeFile("path", "foo", 1)
+	other := writeFile("path.dupfinder-tmp", "bar", 1)
+	if err := Apply(Operation{Action: Hardlink, Keep: keep, Path: path}, journal); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := ioutil.ReadFile(other); err != nil || string(content) != "bar" {
+		t.Errorf("got %q, %v; expected %s untouched", content, err, other)
+	}
+}
+
+func Test_Apply_changes_nothing_if_journal_fails(t *testing.T) {
+	createTempDir()
+	defer deleteTempDir()
+
+	journal, err := OpenJournal(filepath.Join(tempdir, "journal.ndjson"))
+	utils.PanicIfFailed(err)
+	utils.PanicIfFailed(journal.Close())
+
+	keep := writeFile("keep", "foo", 1)
+	deleted := writeFile("deleted", "foo", 1)
+	if err := Apply(Operation{Action: Delete, Keep: keep, Path: deleted}, journal); err == nil {
+		t.Error("expected an error writing to the closed journal")
+	}
+	if _, err := os.Stat(deleted); err != nil {
+		t.Errorf("%s should not have been deleted: %v", deleted, err)
+	}
+}
@@ -0,0 +1,152 @@
+package dedupe
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/janosgyerik/dupfinder/utils"
+)
+
+// Status tells whether a recorded operation was completed
+type Status string
+
+const (
+	// Pending operations are recorded before changing the file system,
+	// they may or may not have been completed
+	Pending Status = "pending"
+
+	// Done operations were completed. Entries of journals written before
+	// statuses were recorded have an empty status, and are done too.
+	Done Status = "done"
+)
+
+// JournalEntry records an operation that changed the file system,
+// with the metadata of the file before the change, to be able to undo it
+type JournalEntry struct {
+	Time      time.Time    `json:"time"`
+	Status    Status       `json:"status,omitempty"`
+	Action    Action       `json:"action"`
+	Path      string       `json:"path"`
+	Keep      string       `json:"keep"`
+	Hash      string       `json:"hash,omitempty"`
+	Algorithm string       `json:"algorithm,omitempty"`
+	Size      int64        `json:"size"`
+	Mode      os.FileMode  `json:"mode"`
+	ModTime   time.Time    `json:"mtime"`
+	Owner     *utils.Owner `json:"owner,omitempty"`
+}
+
+// Journal is an append-only log of operations, one JSON object per line
+type Journal struct {
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func OpenJournal(path string) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+// Record appends the operation to the journal as pending, and flushes it
+// to disk, before the operation changes anything. Once completed,
+// it must be marked with Done. The info is of the file at the path
+// of the operation, before it was changed.
+func (j *Journal) Record(op Operation, info os.FileInfo) (JournalEntry, error) {
+	entry := JournalEntry{
+		Time:      time.Now(),
+		Status:    Pending,
+		Action:    op.Action,
+		Path:      op.Path,
+		Keep:      op.Keep,
+		Hash:      op.Digest,
+		Algorithm: op.Algorithm,
+		Size:      info.Size(),
+		Mode:      info.Mode(),
+		ModTime:   info.ModTime(),
+	}
+	if owner, ok := utils.OwnerOf(info); ok {
+		entry.Owner = &owner
+	}
+	return entry, j.write(entry)
+}
+
+// Done appends a record that the operation of the pending entry was completed
+func (j *Journal) Done(entry JournalEntry) error {
+	entry.Status = Done
+	return j.write(entry)
+}
+
+func (j *Journal) write(entry JournalEntry) error {
+	if err := j.encoder.Encode(entry); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+func (j *Journal) Path() string {
+	return j.file.Name()
+}
+
+// DefaultJournalPath returns a new journal path under the user's cache
+// directory, named after the current time
+func DefaultJournalPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	name := time.Now().Format("20060102-150405") + ".ndjson"
+	return filepath.Join(dir, "dupfinder", "journal", name), nil
+}
+
+// ReadJournal returns the entries of the journal at path, in the order recorded,
+// one per operation: pending entries followed by a done record are done
+func ReadJournal(path string) ([]JournalEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		if entry.Status == Done {
+			if i := lastPending(entries, entry); i >= 0 {
+				entries[i].Status = Done
+				continue
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// lastPending returns the index of the last pending entry
+// of the same operation as the done entry, or -1
+func lastPending(entries []JournalEntry, done JournalEntry) int {
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Status == Pending && e.Action == done.Action && e.Path == done.Path && e.Time.Equal(done.Time) {
+			return i
+		}
+	}
+	return -1
+}
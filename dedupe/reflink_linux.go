@@ -0,0 +1,31 @@
+package dedupe
+
+import (
+	"os"
+	"syscall"
+)
+
+// ioctl request to share the extents of a file with another, see ioctl_ficlone(2)
+const ficlone = 0x40049409
+
+// reflink creates dst as a copy-on-write clone of src,
+// on file systems that support it, such as Btrfs and XFS
+func reflink(src, dst string) error {
+	s, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	d, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, d.Fd(), ficlone, s.Fd())
+	if errno != 0 {
+		return &os.PathError{Op: "reflink", Path: dst, Err: errno}
+	}
+	return nil
+}
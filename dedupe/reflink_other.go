@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package dedupe
+
+import (
+	"errors"
+	"os"
+)
+
+func reflink(src, dst string) error {
+	return &os.PathError{Op: "reflink", Path: dst, Err: errors.New("not supported on this platform")}
+}
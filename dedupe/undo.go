@@ -0,0 +1,180 @@
+package dedupe
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/janosgyerik/dupfinder"
+	"github.com/janosgyerik/dupfinder/utils"
+)
+
+var (
+	// ErrPathExists is returned by Undo when a deleted file cannot be restored
+	// because something else was created at its path since
+	ErrPathExists = errors.New("path exists, not overwriting")
+
+	// ErrNotLinked is returned by Undo when the file is no longer the link
+	// that replaced it
+	ErrNotLinked = errors.New("no longer a link created by dupfinder")
+
+	// ErrSourceChanged is returned by Undo when the content to restore
+	// differs from the content recorded in the journal
+	ErrSourceChanged = errors.New("content to restore differs from the recorded content")
+
+	// ErrNotApplied is returned by Undo for a pending entry
+	// whose operation was not done, so there is nothing to undo
+	ErrNotApplied = errors.New("operation was not done, nothing to undo")
+)
+
+// Undo reverts the operation recorded in the journal entry:
+// hard links and symbolic links are replaced with independent copies,
+// and deleted files are restored from the kept file,
+// with the mode, modification time and owner they had before.
+// Clones made by reflink are already independent copies, and are left alone.
+// Pending entries are reverted only if their operation was done.
+func Undo(entry JournalEntry) error {
+	if entry.Status == Pending {
+		applied, err := isApplied(entry)
+		if err != nil {
+			return undoError(entry, err)
+		}
+		if !applied {
+			return undoError(entry, ErrNotApplied)
+		}
+	}
+
+	var source string
+	switch entry.Action {
+	case Delete:
+		if _, err := os.Lstat(entry.Path); err == nil {
+			return undoError(entry, ErrPathExists)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		source = entry.Keep
+	case Hardlink, Symlink:
+		info, err := os.Lstat(entry.Path)
+		if err != nil {
+			return err
+		}
+		isSymlink := info.Mode()&os.ModeSymlink != 0
+		if entry.Action == Symlink && !isSymlink || entry.Action == Hardlink && !info.Mode().IsRegular() {
+			return undoError(entry, ErrNotLinked)
+		}
+		// the link itself gives access to the content
+		source = entry.Path
+	case Reflink:
+		return nil
+	default:
+		return undoError(entry, fmt.Errorf("invalid action: %q", entry.Action))
+	}
+	return restore(entry, source)
+}
+
+// isApplied returns true if the operation of a pending entry was done,
+// as seen on the file system
+func isApplied(entry JournalEntry) (bool, error) {
+	info, err := os.Lstat(entry.Path)
+	if os.IsNotExist(err) {
+		return entry.Action == Delete, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	switch entry.Action {
+	case Hardlink:
+		keepInfo, err := os.Stat(entry.Keep)
+		if err != nil {
+			return false, err
+		}
+		return os.SameFile(info, keepInfo), nil
+	case Symlink:
+		return info.Mode()&os.ModeSymlink != 0, nil
+	default:
+		return false, nil
+	}
+}
+
+func undoError(entry JournalEntry, err error) error {
+	return &os.PathError{Op: "undo " + string(entry.Action), Path: entry.Path, Err: err}
+}
+
+// restore copies source to a temporary file next to the path of the entry,
+// verifies the content, restores the metadata, and renames it over the path
+func restore(entry JournalEntry, source string) error {
+	hasher, err := entryHasher(entry)
+	if err != nil {
+		return undoError(entry, err)
+	}
+
+	src, err := os.Open(source)
+	if err != nil {
+		return undoError(entry, err)
+	}
+	defer src.Close()
+
+	h := hasher.New()
+	var n int64
+	tmp, err := createTemp(entry.Path, func(tmp string) error {
+		dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		n, err = io.Copy(io.MultiWriter(dst, h), src)
+		if closeErr := dst.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	})
+	if err != nil {
+		return undoError(entry, err)
+	}
+	if n != entry.Size || entry.Hash != "" && fmt.Sprintf("%x", h.Sum(nil)) != entry.Hash {
+		err = ErrSourceChanged
+	}
+	if err == nil {
+		err = restoreMetadata(tmp, entry)
+	}
+	if err == nil {
+		err = os.Rename(tmp, entry.Path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return undoError(entry, err)
+	}
+	return nil
+}
+
+// entryHasher returns the hash algorithm of the digest in the entry,
+// SHA-256 for journals written before the algorithm was recorded
+func entryHasher(entry JournalEntry) (dupfinder.Hasher, error) {
+	if entry.Algorithm == "" {
+		return dupfinder.Hashers.SHA256, nil
+	}
+	hasher, ok := dupfinder.HasherByName(entry.Algorithm)
+	if !ok {
+		return nil, fmt.Errorf("unknown hash algorithm: %q", entry.Algorithm)
+	}
+	return hasher, nil
+}
+
+func restoreMetadata(path string, entry JournalEntry) error {
+	if entry.Owner != nil {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		// changing the owner usually needs privileges, so only try when necessary
+		if owner, ok := utils.OwnerOf(info); ok && owner != *entry.Owner {
+			if err := os.Chown(path, entry.Owner.Uid, entry.Owner.Gid); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.Chmod(path, entry.Mode.Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(path, entry.ModTime, entry.ModTime)
+}
@@ -0,0 +1,182 @@
+package dedupe
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/janosgyerik/dupfinder/hashes"
+	"github.com/janosgyerik/dupfinder/utils"
+)
+
+func Test_Undo(t *testing.T) {
+	createTempDir()
+	defer deleteTempDir()
+
+	journalPath := filepath.Join(tempdir, "journal.ndjson")
+	journal, err := OpenJournal(journalPath)
+	utils.PanicIfFailed(err)
+
+	keep := writeFile("keep", "foo", 1)
+	deleted := writeFile("deleted", "foo", 2)
+	utils.PanicIfFailed(os.Chmod(deleted, 0600))
+	hardlinked := writeFile("hardlinked", "foo", 3)
+	symlinked := writeFile("symlinked", "foo", 4)
+	recreated := writeFile("recreated", "foo", 5)
+
+	originals := make(map[string]os.FileInfo)
+	for _, path := range []string{deleted, hardlinked, symlinked} {
+		originals[path], err = os.Stat(path)
+		utils.PanicIfFailed(err)
+	}
+
+	ops := []Operation{
+		{Action: Delete, Keep: keep, Path: deleted},
+		{Action: Hardlink, Keep: keep, Path: hardlinked},
+		{Action: Symlink, Keep: keep, Path: symlinked},
+		{Action: Delete, Keep: keep, Path: recreated},
+	}
+	for _, op := range ops {
+		utils.PanicIfFailed(Apply(op, journal))
+	}
+	utils.PanicIfFailed(journal.Close())
+
+	utils.PanicIfFailed(ioutil.WriteFile(recreated, []byte("new"), 0644))
+
+	entries, err := ReadJournal(journalPath)
+	utils.PanicIfFailed(err)
+	for _, entry := range entries[:3] {
+		if err := Undo(entry); err != nil {
+			t.Errorf("undo %s: %v", entry.Path, err)
+		}
+	}
+	if err := Undo(entries[3]); err == nil || err.(*os.PathError).Err != ErrPathExists {
+		t.Errorf("got %v; expected %v", err, ErrPathExists)
+	}
+
+	keepInfo, _ := os.Stat(keep)
+	for path, original := range originals {
+		info, err := os.Lstat(path)
+		if err != nil {
+			t.Errorf("%s not restored: %v", path, err)
+			continue
+		}
+		if !info.Mode().IsRegular() || os.SameFile(info, keepInfo) {
+			t.Errorf("%s is not an independent copy", path)
+		}
+		if info.Mode() != original.Mode() || !info.ModTime().Equal(original.ModTime()) {
+			t.Errorf("%s: got %v %v; expected %v %v", path, info.Mode(), info.ModTime(), original.Mode(), original.ModTime())
+		}
+		if content, _ := ioutil.ReadFile(path); string(content) != "foo" {
+			t.Errorf("%s: got content %q; expected %q", path, content, "foo")
+		}
+	}
+}
+
+func Test_Undo_changedSource(t *testing.T) {
+	createTempDir()
+	defer deleteTempDir()
+
+	journal, err := OpenJournal(filepath.Join(tempdir, "journal.ndjson"))
+	utils.PanicIfFailed(err)
+	defer journal.Close()
+
+	keep := writeFile("keep", "foo", 1)
+	deleted := writeFile("deleted", "foo", 1)
+	utils.PanicIfFailed(Apply(Operation{Action: Delete, Keep: keep, Path: deleted}, journal))
+
+	entries, err := ReadJournal(journal.Path())
+	utils.PanicIfFailed(err)
+
+	utils.PanicIfFailed(ioutil.WriteFile(keep, []byte("changed"), 0644))
+	if err := Undo(entries[0]); err == nil || err.(*os.PathError).Err != ErrSourceChanged {
+		t.Errorf("got %v; expected %v", err, ErrSourceChanged)
+	}
+	if _, err := os.Lstat(deleted); !os.IsNotExist(err) {
+		t.Errorf("%s should not have been restored", deleted)
+	}
+}
+
+func Test_Undo_verifies_with_recorded_algorithm(t *testing.T) {
+	createTempDir()
+	defer deleteTempDir()
+
+	journal, err := OpenJournal(filepath.Join(tempdir, "journal.ndjson"))
+	utils.PanicIfFailed(err)
+	defer journal.Close()
+
+	h := hashes.NewBLAKE3()
+	h.Write([]byte("foo"))
+	digest := fmt.Sprintf("%x", h.Sum(nil))
+
+	keep := writeFile("keep", "foo", 1)
+	deleted := writeFile("deleted", "foo", 1)
+	unknown := writeFile("unknown", "foo", 1)
+	utils.PanicIfFailed(Apply(Operation{Action: Delete, Keep: keep, Path: deleted, Digest: digest, Algorithm: "blake3"}, journal))
+	utils.PanicIfFailed(Apply(Operation{Action: Delete, Keep: keep, Path: unknown, Digest: digest, Algorithm: "md5"}, journal))
+
+	entries, err := ReadJournal(journal.Path())
+	utils.PanicIfFailed(err)
+
+	if err := Undo(entries[0]); err != nil {
+		t.Errorf("undo %s: %v", deleted, err)
+	}
+	if content, _ := ioutil.ReadFile(deleted); string(content) != "foo" {
+		t.Errorf("%s: got content %q; expected %q", deleted, content, "foo")
+	}
+	if err := Undo(entries[1]); err == nil {
+		t.Errorf("expected an error for an unknown algorithm")
+	}
+	if _, err := os.Lstat(unknown); !os.IsNotExist(err) {
+		t.Errorf("%s should not have been restored", unknown)
+	}
+}
+
+func Test_Undo_pending_entries(t *testing.T) {
+	createTempDir()
+	defer deleteTempDir()
+
+	journal, err := OpenJournal(filepath.Join(tempdir, "journal.ndjson"))
+	utils.PanicIfFailed(err)
+	defer journal.Close()
+
+	keep := writeFile("keep", "foo", 1)
+	deleted := writeFile("deleted", "foo", 2)
+	notDeleted := writeFile("not-deleted", "foo", 3)
+	notLinked := writeFile("not-linked", "foo", 4)
+
+	// as if interrupted after recording the operations, having done only one
+	for _, op := range []Operation{
+		{Action: Delete, Keep: keep, Path: deleted},
+		{Action: Delete, Keep: keep, Path: notDeleted},
+		{Action: Hardlink, Keep: keep, Path: notLinked},
+	} {
+		info, err := os.Lstat(op.Path)
+		utils.PanicIfFailed(err)
+		_, err = journal.Record(op, info)
+		utils.PanicIfFailed(err)
+	}
+	utils.PanicIfFailed(os.Remove(deleted))
+
+	entries, err := ReadJournal(journal.Path())
+	utils.PanicIfFailed(err)
+	for _, entry := range entries {
+		if entry.Status != Pending {
+			t.Errorf("%s: got status %q; expected %q", entry.Path, entry.Status, Pending)
+		}
+	}
+
+	if err := Undo(entries[0]); err != nil {
+		t.Errorf("undo %s: %v", deleted, err)
+	}
+	if content, _ := ioutil.ReadFile(deleted); string(content) != "foo" {
+		t.Errorf("%s: got content %q; expected %q", deleted, content, "foo")
+	}
+	for _, entry := range entries[1:] {
+		if err := Undo(entry); err == nil || err.(*os.PathError).Err != ErrNotApplied {
+			t.Errorf("%s: got %v; expected %v", entry.Path, err, ErrNotApplied)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package dupfinder
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/janosgyerik/dupfinder/utils"
+)
+
+// TreeDiff compares two directory trees A and B by the content of their files.
+// Paths are relative to the roots of the trees. OnlyInA and OnlyInB are
+// the files whose content is not anywhere in the other tree, Changed the
+// relative paths in both trees with different content, and Moved the content
+// in both trees at different relative paths. Identical counts the relative
+// paths in both trees with the same content.
+type TreeDiff struct {
+	OnlyInA   []string
+	OnlyInB   []string
+	Changed   []string
+	Moved     []Move
+	Identical int
+}
+
+// Move is content at different relative paths in two trees: A are the paths
+// in tree A that are not in tree B, and B the paths in tree B that are not
+// in tree A. When the content is also at the same path in both trees,
+// and so one side would be empty, it lists all the paths on that side.
+type Move struct {
+	A []string
+	B []string
+}
+
+// Empty reports whether the trees have the same content at the same paths
+func (diff TreeDiff) Empty() bool {
+	return len(diff.OnlyInA) == 0 && len(diff.OnlyInB) == 0 && len(diff.Changed) == 0 && len(diff.Moved) == 0
+}
+
+// relativeTo returns the path relative to the root, if it is under the root
+func relativeTo(root, path string) (string, bool) {
+	if !utils.IsUnder(root, path) {
+		return "", false
+	}
+	rel, err := filepath.Rel(root, path)
+	return rel, err == nil && rel != "."
+}
+
+// diffSide is the content of a group in one of the trees
+type diffSide struct {
+	paths    []string
+	unpaired []string
+}
+
+// Diff compares the files added under the directories a and b,
+// hard links included. The directories must not contain each other.
+func (t *tracker) Diff(a, b string) TreeDiff {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	inA := make(map[string]*group)
+	inB := make(map[string]*group)
+	for _, g := range t.groups {
+		for _, item := range g.items {
+			for _, path := range item.paths() {
+				if rel, ok := relativeTo(a, path); ok {
+					inA[rel] = g
+				} else if rel, ok := relativeTo(b, path); ok {
+					inB[rel] = g
+				}
+			}
+		}
+	}
+
+	diff := TreeDiff{OnlyInA: []string{}, OnlyInB: []string{}, Changed: []string{}, Moved: []Move{}}
+	sidesA := make(map[*group]*diffSide)
+	sidesB := make(map[*group]*diffSide)
+	side := func(sides map[*group]*diffSide, g *group) *diffSide {
+		if s, ok := sides[g]; ok {
+			return s
+		}
+		s := &diffSide{}
+		sides[g] = s
+		return s
+	}
+
+	for rel, g := range inA {
+		s := side(sidesA, g)
+		s.paths = append(s.paths, rel)
+		other, ok := inB[rel]
+		switch {
+		case !ok:
+			s.unpaired = append(s.unpaired, rel)
+		case other == g:
+			diff.Identical++
+		default:
+			diff.Changed = append(diff.Changed, rel)
+		}
+	}
+	for rel, g := range inB {
+		s := side(sidesB, g)
+		s.paths = append(s.paths, rel)
+		if _, ok := inA[rel]; !ok {
+			s.unpaired = append(s.unpaired, rel)
+		}
+	}
+
+	for g, sa := range sidesA {
+		sb, ok := sidesB[g]
+		if !ok {
+			diff.OnlyInA = append(diff.OnlyInA, sa.unpaired...)
+			continue
+		}
+		if len(sa.unpaired) == 0 && len(sb.unpaired) == 0 {
+			continue
+		}
+		move := Move{A: sa.unpaired, B: sb.unpaired}
+		if len(move.A) == 0 {
+			move.A = sa.paths
+		}
+		if len(move.B) == 0 {
+			move.B = sb.paths
+		}
+		sort.Strings(move.A)
+		sort.Strings(move.B)
+		diff.Moved = append(diff.Moved, move)
+	}
+	for g, sb := range sidesB {
+		if _, ok := sidesA[g]; !ok {
+			diff.OnlyInB = append(diff.OnlyInB, sb.unpaired...)
+		}
+	}
+
+	sort.Strings(diff.OnlyInA)
+	sort.Strings(diff.OnlyInB)
+	sort.Strings(diff.Changed)
+	sort.Slice(diff.Moved, func(i, j int) bool { return diff.Moved[i].A[0] < diff.Moved[j].A[0] })
+	return diff
+}
@@ -0,0 +1,72 @@
+package dupfinder
+
+import (
+	"path"
+	"reflect"
+	"testing"
+)
+
+func Test_Diff(t *testing.T) {
+	fdata := []fileData{
+		{"a/same", "same"},
+		{"b/same", "same"},
+		{"a/changed", "old content"},
+		{"b/changed", "new content"},
+		{"a/old/name", "moved"},
+		{"b/new/name", "moved"},
+		{"a/copied", "copied"},
+		{"b/copied", "copied"},
+		{"b/copied2", "copied"},
+		{"a/deleted", "deleted"},
+		{"b/added", "added"},
+		{"c/other", "deleted"},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	tracker := NewTracker()
+	for _, v := range fdata {
+		tracker.Add(path.Join(tempdir, v.relpath))
+	}
+
+	expected := TreeDiff{
+		OnlyInA: []string{"deleted"},
+		OnlyInB: []string{"added"},
+		Changed: []string{"changed"},
+		Moved: []Move{
+			{A: []string{"copied"}, B: []string{"copied2"}},
+			{A: []string{"old/name"}, B: []string{"new/name"}},
+		},
+		Identical: 2,
+	}
+	actual := tracker.Diff(path.Join(tempdir, "a"), path.Join(tempdir, "b"))
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("got:\n%#v\nexpected:\n%#v", actual, expected)
+	}
+	if actual.Empty() {
+		t.Error("got empty diff")
+	}
+}
+
+func Test_Diff_reports_missing_empty_files(t *testing.T) {
+	fdata := []fileData{
+		{"a/config", "x"},
+		{"b/config", "x"},
+		{"a/empty-config", ""},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	tracker := NewTracker()
+	for _, v := range fdata {
+		tracker.Add(path.Join(tempdir, v.relpath))
+	}
+
+	expected := TreeDiff{OnlyInA: []string{"empty-config"}, OnlyInB: []string{}, Changed: []string{}, Moved: []Move{}, Identical: 1}
+	actual := tracker.Diff(path.Join(tempdir, "a"), path.Join(tempdir, "b"))
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("got:\n%#v\nexpected:\n%#v", actual, expected)
+	}
+}
@@ -0,0 +1,166 @@
+package dupfinder
+
+import (
+	"hash"
+	"io"
+	"os"
+)
+
+// number of bytes hashed at the start and at the end of a file
+// to tell apart files of the same size cheaply
+const partialSize = 4096
+
+// partialCoversAll reports whether the partial digest of a file
+// of the given size already covers its entire content
+func partialCoversAll(size int64) bool {
+	return size <= 2*partialSize
+}
+
+func (t *tracker) partialDigest(item *fileItem) (string, error) {
+	if item.partial != "" {
+		return item.partial, nil
+	}
+
+	f, err := os.Open(item.path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	t.fileStarted(item.path)
+
+	h := t.hasher.New()
+
+	head := item.size
+	if head > partialSize {
+		head = partialSize
+	}
+	if err := t.copyN(h, f, head); err != nil {
+		return "", err
+	}
+
+	if item.size > head {
+		tailStart := item.size - partialSize
+		if tailStart < head {
+			tailStart = head
+		}
+		if _, err := f.Seek(tailStart, io.SeekStart); err != nil {
+			return "", err
+		}
+		if err := t.copyN(h, f, item.size-tailStart); err != nil {
+			return "", err
+		}
+	}
+
+	item.partial = string(h.Sum(nil))
+	t.cache.Put(item.path, item.info, t.hasher.Name(), item.partial, item.full)
+	return item.partial, nil
+}
+
+func (t *tracker) fullDigest(item *fileItem) (string, error) {
+	if item.full != "" {
+		return item.full, nil
+	}
+
+	if partialCoversAll(item.size) {
+		digest, err := t.partialDigest(item)
+		if err != nil {
+			return "", err
+		}
+		item.full = digest
+		return item.full, nil
+	}
+
+	f, err := os.Open(item.path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	t.fileStarted(item.path)
+
+	h := t.hasher.New()
+	if err := t.copyN(h, f, item.size); err != nil {
+		return "", err
+	}
+
+	item.full = string(h.Sum(nil))
+	t.cache.Put(item.path, item.info, t.hasher.Name(), item.partial, item.full)
+	return item.full, nil
+}
+
+// setFullDigest sets the full digest of the file if not known yet,
+// when computed along with something else
+func (t *tracker) setFullDigest(item *fileItem, digest string) {
+	if item.full != "" {
+		return
+	}
+	item.full = digest
+	t.cache.Put(item.path, item.info, t.hasher.Name(), item.partial, item.full)
+}
+
+// partialBytes returns the number of bytes to read for the partial digest
+func partialBytes(item *fileItem) int64 {
+	if item.partial != "" {
+		return 0
+	}
+	if partialCoversAll(item.size) {
+		return item.size
+	}
+	return 2 * partialSize
+}
+
+// contentBytes returns the number of bytes to read for the content digest,
+// once the partial digest is known
+func (t *tracker) contentBytes(item *fileItem) int64 {
+	if t.isSampled(item.size) {
+		if item.sampled != "" {
+			return 0
+		}
+		var n int64
+		for _, r := range t.sampling.ranges(item.size) {
+			n += r.end - r.start
+		}
+		return n
+	}
+	if item.full != "" || partialCoversAll(item.size) {
+		return 0
+	}
+	return item.size
+}
+
+func sumBytes(items []*fileItem, bytes func(*fileItem) int64) int64 {
+	var sum int64
+	for _, item := range items {
+		sum += bytes(item)
+	}
+	return sum
+}
+
+// countingReader reports the bytes read to the event listener as they are read
+type countingReader struct {
+	reader  io.Reader
+	tracker *tracker
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	if err := r.tracker.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.tracker.bytesRead(n)
+	}
+	return n, err
+}
+
+// copyN feeds exactly n bytes of f into h,
+// failing if the file turns out to be shorter than expected
+func (t *tracker) copyN(h hash.Hash, f *os.File, n int64) error {
+	written, err := io.CopyBuffer(h, countingReader{io.LimitReader(f, n), t}, make([]byte, 64*chunkSize))
+	if err != nil {
+		return err
+	}
+	if written != n {
+		return &os.PathError{Op: "read", Path: f.Name(), Err: io.ErrUnexpectedEOF}
+	}
+	return nil
+}
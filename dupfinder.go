@@ -1,45 +1,129 @@
 package dupfinder
 
 import (
+	"context"
 	"os"
 	"sort"
 	"io"
-	"reflect"
+	"bytes"
+	"sync"
+	"encoding/hex"
+	"errors"
+	"hash"
+
 	"github.com/janosgyerik/dupfinder/utils"
 )
 
 const chunkSize = 4096
 
+// EventListener receives the progress of a tracker.
+// GroupCreated is called when a second file joins a group, making it
+// a group of duplicates, GroupGrew when further files join it.
+// FileSkipped is called for each file that could not be added,
+// with the same error returned by Add or AddAll.
+// PhaseChanged is called when AddAll moves on to the next Phase,
+// with the number of files and bytes to read in that phase, as far as known.
+// FileStarted is called when a file starts being read,
+// BytesRead as its content is read. Calls are never concurrent.
+// Progress implements EventListener to keep track of these.
 type EventListener interface {
-	NewDuplicate([]string)
+	GroupCreated(event GroupEvent)
+	GroupGrew(event GroupEvent)
+	FileSkipped(path string, err error)
+	PhaseChanged(phase Phase, files int, bytes int64)
+	FileStarted(path string)
 	BytesRead(count int)
 }
 
-type nullEventListener struct{}
-
-func (eventListener *nullEventListener) NewDuplicate([]string) {}
-
-func (eventListener *nullEventListener) BytesRead(int) {}
-
+// Tracker groups the files added to it by identical content.
+// Errors returned by Add are *os.PathError values naming the file that
+// could not be read. That may be a previously added file that vanished
+// or became unreadable since; either way the named file is no longer tracked.
+// Add is safe for concurrent use, AddAll reads and hashes files
+// with the number of workers set by Options.Jobs.
+// Paths that are hard links of an already added file are not read,
+// they are reported by Links instead of Groups.
+// Uniques and Missing report the files without copies instead,
+// Contents reports every distinct content.
+// AddContext and AddAllContext stop reading files when the context is done,
+// and return the error of the context. Files that could not be read
+// because of that are not added, the groups of the others stay valid.
 type Tracker interface {
-	Add(path string)
+	Add(path string) error
+	AddContext(ctx context.Context, path string) error
+	AddAll(paths <-chan string) []error
+	AddAllContext(ctx context.Context, paths <-chan string) []error
 	Dups() [][]string
+	Groups() []Group
+	Links() [][]string
+	Uniques() []string
+	Missing() []string
+	Contents() [][]string
+	Report() Report
+	Snapshot() Snapshot
+	DupTrees() []TreeGroup
+	SubTrees() []SubTree
+	Diff(a, b string) TreeDiff
 	SetEventListener(EventListener)
 }
 
+// DigestCache stores the digests of files across runs,
+// computed with the hash algorithm of the given name.
+// Implementations must be safe for concurrent use.
+type DigestCache interface {
+	Get(path string, info os.FileInfo, hash string) (partial, full string, ok bool)
+	Put(path string, info os.FileInfo, hash, partial, full string)
+}
+
+type nullCache struct{}
+
+func (cache nullCache) Get(string, os.FileInfo, string) (string, string, bool) { return "", "", false }
+
+func (cache nullCache) Put(string, os.FileInfo, string, string, string) {}
+
 type fileItem struct {
-	path string
-	size int64
+	path    string
+	size    int64
+	info    os.FileInfo
+	partial string
+	full    string
+	sampled string
+	links   []string
+
+	// symlink is set if the path is a followed symbolic link,
+	// symlinks are the paths of followed symbolic links to the file
+	symlink  bool
+	symlinks []string
+
+	reference bool
 }
 
-func newFileItem(path string) *fileItem {
-	return &fileItem{path, utils.FileSize(path)}
+func (t *tracker) newFileItem(path string) (*fileItem, error) {
+	linfo, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	info := linfo
+	if linfo.Mode()&os.ModeSymlink != 0 {
+		if info, err = os.Stat(path); err != nil {
+			return nil, err
+		}
+	}
+	item := &fileItem{path: path, size: info.Size(), info: info, symlink: info != linfo, reference: t.references.contains(path)}
+	if partial, full, ok := t.cache.Get(path, info, t.hasher.Name()); ok {
+		item.partial = partial
+		item.full = full
+	}
+	t.resume(item)
+	return item, nil
 }
 
 type group struct {
-	items   []*fileItem
-	paths   []string
-	tracker *tracker
+	id       int
+	items    []*fileItem
+	paths    []string
+	tracker  *tracker
+	probable bool
 }
 
 func (g *group) add(item *fileItem) {
@@ -47,110 +131,579 @@ func (g *group) add(item *fileItem) {
 	g.paths = append(g.paths, item.path)
 }
 
-func (g *group) fits(item *fileItem) bool {
-	p1 := g.items[0].path
+// fits compares the file with the first file of the group byte by byte.
+// Files matched by sampled digests get their full digests computed
+// along the way, so that verified groups report them.
+func (g *group) fits(item *fileItem) (bool, error) {
+	first := g.items[0]
+	p1 := first.path
 	p2 := item.path
 
 	f1, err := os.Open(p1)
-	utils.PanicIfFailed(err)
+	if err != nil {
+		return false, err
+	}
 	defer f1.Close()
 
 	f2, err := os.Open(p2)
-	utils.PanicIfFailed(err)
+	if err != nil {
+		return false, err
+	}
 	defer f2.Close()
 
 	buf1 := make([]byte, chunkSize)
 	buf2 := make([]byte, chunkSize)
 
+	var h1, h2 hash.Hash
+	if first.full == "" || item.full == "" {
+		h1, h2 = g.tracker.hasher.New(), g.tracker.hasher.New()
+	}
+
 	for {
-		n1, err1 := f1.Read(buf1)
-		n2, err2 := f2.Read(buf2)
+		n1, err1 := io.ReadFull(f1, buf1)
+		n2, err2 := io.ReadFull(f2, buf2)
 
-		g.tracker.eventListener.BytesRead(n1 + n2)
+		g.tracker.bytesRead(n1 + n2)
+		if err := g.tracker.ctx.Err(); err != nil {
+			return false, err
+		}
 
-		if n1 == 0 {
-			return err1 == io.EOF && err2 == io.EOF
+		if err1 != nil && !isEndOfFile(err1) {
+			return false, err1
+		}
+		if err2 != nil && !isEndOfFile(err2) {
+			return false, err2
 		}
 
-		if !reflect.DeepEqual(buf1, buf2) {
-			return false
+		if !bytes.Equal(buf1[:n1], buf2[:n2]) {
+			return false, nil
+		}
+		if h1 != nil {
+			h1.Write(buf1[:n1])
+			h2.Write(buf2[:n2])
 		}
+
+		if err1 != nil || err2 != nil {
+			same := err1 != nil && err2 != nil
+			if same && h1 != nil {
+				g.tracker.setFullDigest(first, string(h1.Sum(nil)))
+				g.tracker.setFullDigest(item, string(h2.Sum(nil)))
+			}
+			return same, nil
+		}
+	}
+}
+
+func isEndOfFile(err error) bool {
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+func (g *group) export() Group {
+	items := make([]*fileItem, len(g.items))
+	copy(items, g.items)
+	sort.Sort(byPath(items))
+
+	exported := Group{ID: g.id, Size: items[0].size, Probable: g.probable}
+	for _, item := range items {
+		exported.Paths = append(exported.Paths, item.path)
+		exported.Infos = append(exported.Infos, item.info)
+		exported.References = append(exported.References, item.reference)
+		exported.Symlinked = append(exported.Symlinked, len(item.symlinks) > 0)
 	}
+	if !g.probable {
+		exported.Digest = hex.EncodeToString([]byte(g.items[0].full))
+		exported.Algorithm = g.tracker.hasher.Name()
+	}
+	return exported
 }
 
 func newGroup(t *tracker, item *fileItem) *group {
-	g := &group{tracker: t}
+	t.lastGroupID++
+	g := &group{id: t.lastGroupID, tracker: t}
 	g.add(item)
 	return g
 }
 
+// files of the same size, split further by partial digest
+// once a second file of that size shows up
+type sizeBucket struct {
+	lone      *group
+	byPartial map[string]*partialBucket
+}
+
+// files of the same size and partial digest, split further by full digest,
+// or sampled digest in lazy mode, once a second such file shows up
+type partialBucket struct {
+	lone   *group
+	byFull map[string][]*group
+}
+
 type tracker struct {
+	mutex         sync.Mutex
 	groups        []*group
-	indexBySize   map[int64][]*group
+	indexBySize   map[int64]*sizeBucket
+	byFileID      map[utils.FileID]*fileItem
 	eventListener EventListener
+	lastGroupID   int
+	listenerMutex sync.Mutex
+	verify        bool
+	jobs          int
+	cache         DigestCache
+	hasher        Hasher
+	sampling      *Sampling
+	references    *dirSet
+	roots         *dirSet
+	ctx           context.Context
+
+	resumed         map[string]SnapshotFile
+	resumedSampling *Sampling
+	resumedHash     string
 }
 
-func (t *tracker) Add(path string) {
-	item := newFileItem(path)
+func (t *tracker) Add(path string) error {
+	return t.AddContext(context.Background(), path)
+}
+
+func (t *tracker) AddContext(ctx context.Context, path string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.ctx = ctx
+	defer func() { t.ctx = context.Background() }()
+
+	item, err := t.newFileItem(path)
+	if err == nil {
+		err = t.add(item)
+	}
+	if err != nil && t.cancelled(err) {
+		return ctx.Err()
+	}
+	if err != nil {
+		t.skipped(err)
+	}
+	return err
+}
+
+// cancelled reports whether the error is caused by the context being done
+func (t *tracker) cancelled(err error) bool {
+	return t.ctx.Err() != nil && errors.Is(err, t.ctx.Err())
+}
+
+// AddAll adds all paths received from the channel, and returns the errors
+// of the files that could not be added. Files are read in parallel stages:
+// first the sizes, then the partial digests of files whose size is not unique,
+// then the full digests of files whose partial digest is not unique.
+// The files are then grouped in the order received,
+// so the result does not depend on the number of workers.
+func (t *tracker) AddAll(paths <-chan string) []error {
+	return t.AddAllContext(context.Background(), paths)
+}
+
+// AddAllContext is AddAll stopping when the context is done. The files
+// whose digests were computed by then are still grouped, so the groups
+// are a partial result. The error of the context is the last error returned.
+func (t *tracker) AddAllContext(ctx context.Context, paths <-chan string) []error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.ctx = ctx
+	defer func() { t.ctx = context.Background() }()
+
+	var all []string
+	for path := range paths {
+		all = append(all, path)
+	}
+
+	t.phaseChanged(PhaseStat, len(all), 0)
+	created := make([]*fileItem, len(all))
+	errs := t.parallel(len(all), func(i int) error {
+		item, err := t.newFileItem(all[i])
+		created[i] = item
+		return err
+	})
+	errs = t.skipped(errs...)
+
+	var items []*fileItem
+	for _, item := range created {
+		if item != nil {
+			items = append(items, item)
+		}
+	}
+
+	// hard links of files already seen need not be read
+	var distinct []*fileItem
+	seenIDs := make(map[utils.FileID]bool)
+	for _, item := range items {
+		if id, ok := utils.FileIDOf(item.info); ok {
+			if _, tracked := t.byFileID[id]; tracked || seenIDs[id] {
+				continue
+			}
+			seenIDs[id] = true
+		}
+		distinct = append(distinct, item)
+	}
+
+	sizeCount := make(map[int64]int)
+	for _, item := range distinct {
+		sizeCount[item.size]++
+	}
+	var sameSize []*fileItem
+	for _, item := range distinct {
+		if _, seen := t.indexBySize[item.size]; seen || sizeCount[item.size] > 1 {
+			sameSize = append(sameSize, item)
+		}
+	}
+	t.phaseChanged(PhasePartialDigest, len(sameSize), sumBytes(sameSize, partialBytes))
+	items, errs = t.hashAll(items, sameSize, errs, t.partialDigest)
+
+	type partialKey struct {
+		size    int64
+		partial string
+	}
+	partialCount := make(map[partialKey]int)
+	for _, item := range sameSize {
+		if item.partial != "" {
+			partialCount[partialKey{item.size, item.partial}]++
+		}
+	}
+	var samePartial []*fileItem
+	for _, item := range sameSize {
+		if item.partial != "" && !partialCoversAll(item.size) && partialCount[partialKey{item.size, item.partial}] > 1 {
+			samePartial = append(samePartial, item)
+		}
+	}
+	t.phaseChanged(PhaseFullDigest, len(samePartial), sumBytes(samePartial, t.contentBytes))
+	items, errs = t.hashAll(items, samePartial, errs, t.contentDigest)
+
+	t.phaseChanged(PhaseGrouping, len(items), 0)
+	for _, item := range items {
+		if err := t.add(item); err != nil {
+			errs = append(errs, t.skipped(err)...)
+		}
+	}
+	t.phaseChanged(PhaseDone, 0, 0)
+	if ctx.Err() != nil {
+		errs = append(errs, ctx.Err())
+	}
+	return errs
+}
 
-	for _, g := range t.indexBySize[item.size] {
-		if g.fits(item) {
-			g.add(item)
-			t.eventListener.NewDuplicate(g.paths)
+// hashAll computes digests of the selected items in parallel,
+// and returns the items without the ones that failed, and the errors extended
+func (t *tracker) hashAll(items, selected []*fileItem, errs []error, digest func(*fileItem) (string, error)) ([]*fileItem, []error) {
+	failed := make([]bool, len(selected))
+	errs = append(errs, t.skipped(t.parallel(len(selected), func(i int) error {
+		_, err := digest(selected[i])
+		failed[i] = err != nil
+		return err
+	})...)...)
+
+	excluded := make(map[*fileItem]bool)
+	for i, item := range selected {
+		if failed[i] {
+			excluded[item] = true
+		}
+	}
+	if len(excluded) == 0 {
+		return items, errs
+	}
+
+	var remaining []*fileItem
+	for _, item := range items {
+		if !excluded[item] {
+			remaining = append(remaining, item)
+		}
+	}
+	return remaining, errs
+}
+
+// add groups the item with the files of identical content,
+// or with the file it is a hard link or a symbolic link of
+func (t *tracker) add(item *fileItem) error {
+	if id, ok := utils.FileIDOf(item.info); ok {
+		if first, ok := t.byFileID[id]; ok {
+			if first.path != item.path {
+				first.addLink(item)
+			}
+			return nil
+		}
+	}
+
+	sb, ok := t.indexBySize[item.size]
+	if !ok {
+		t.indexBySize[item.size] = &sizeBucket{lone: t.newGroup(item)}
+		return nil
+	}
+
+	if sb.lone != nil {
+		rep := sb.lone
+		digest, err := t.partialDigest(rep.items[0])
+		if err != nil && t.cancelled(err) {
+			return err
+		}
+		if err != nil {
+			t.drop(rep)
+			sb.lone = t.newGroup(item)
+			return err
+		}
+		sb.byPartial = map[string]*partialBucket{digest: {lone: rep}}
+		sb.lone = nil
+	}
+
+	partial, err := t.partialDigest(item)
+	if err != nil {
+		return err
+	}
+
+	pb, ok := sb.byPartial[partial]
+	if !ok {
+		sb.byPartial[partial] = &partialBucket{lone: t.newGroup(item)}
+		return nil
+	}
+
+	if pb.lone != nil {
+		rep := pb.lone
+		digest, err := t.contentDigest(rep.items[0])
+		if err != nil && t.cancelled(err) {
+			return err
+		}
+		if err != nil {
+			t.drop(rep)
+			pb.lone = t.newGroup(item)
+			return err
+		}
+		pb.byFull = map[string][]*group{digest: {rep}}
+		pb.lone = nil
+	}
+
+	full, err := t.contentDigest(item)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range pb.byFull[full] {
+		if t.verify {
+			fits, err := g.fits(item)
+			if err != nil {
+				return &os.PathError{Op: "verify", Path: item.path, Err: err}
+			}
+			if !fits {
+				continue
+			}
+		}
+		reported := g.reportable()
+		g.add(item)
+		t.track(item)
+		if !t.verify && t.isSampled(item.size) {
+			g.probable = true
+		}
+		if !g.reportable() {
+			return nil
+		}
+		event := g.event(item.path)
+		if !reported {
+			t.emit(func(listener EventListener) { listener.GroupCreated(event) })
+		} else {
+			t.emit(func(listener EventListener) { listener.GroupGrew(event) })
+		}
+		return nil
+	}
+
+	pb.byFull[full] = append(pb.byFull[full], t.newGroup(item))
+	return nil
+}
+
+// addLink records the path of another item of the same file.
+// A file found after a symbolic link to it takes the place of the link,
+// so that the path of the item is the file itself when it is scanned.
+func (item *fileItem) addLink(other *fileItem) {
+	switch {
+	case other.symlink:
+		item.symlinks = append(item.symlinks, other.path)
+	case item.symlink:
+		item.symlinks = append(item.symlinks, item.path)
+		item.path, item.symlink = other.path, false
+	default:
+		item.links = append(item.links, other.path)
+	}
+}
+
+func (t *tracker) newGroup(item *fileItem) *group {
+	g := newGroup(t, item)
+	t.groups = append(t.groups, g)
+	t.track(item)
+	return g
+}
+
+// track registers the identity of the file, to recognize its hard links
+func (t *tracker) track(item *fileItem) {
+	if id, ok := utils.FileIDOf(item.info); ok {
+		t.byFileID[id] = item
+	}
+}
+
+// drop forgets about a group whose only file could not be read
+func (t *tracker) drop(g *group) {
+	for _, item := range g.items {
+		if id, ok := utils.FileIDOf(item.info); ok {
+			delete(t.byFileID, id)
+		}
+	}
+	for i, other := range t.groups {
+		if other == g {
+			t.groups = append(t.groups[:i], t.groups[i+1:]...)
 			return
 		}
 	}
+}
 
-	group := newGroup(t, item)
-	t.groups = append(t.groups, group)
-	t.indexBySize[item.size] = append(t.indexBySize[item.size], group)
+// IsSymlinked reports whether followed symbolic links point at
+// the i-th path of the group, that would dangle if it was removed
+func (g Group) IsSymlinked(i int) bool {
+	return i < len(g.Symlinked) && g.Symlinked[i]
 }
 
-type byPath []string
+type byPath []*fileItem
 
 func (a byPath) Len() int           { return len(a) }
 func (a byPath) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a byPath) Less(i, j int) bool { return a[i] < a[j] }
+func (a byPath) Less(i, j int) bool { return a[i].path < a[j].path }
 
-type bySizeAndFirstPath [][]string
+// Group is a set of files with identical content. Digest is the hex
+// encoded digest of the content, computed with the hash Algorithm.
+// Probable groups were matched by sampling only parts of the files,
+// in lazy mode, and have no Digest nor Algorithm. Infos holds the file info
+// of each path, References whether it is a reference file, Symlinked
+// whether followed symbolic links point at it. ID identifies the group in events.
+type Group struct {
+	ID         int
+	Paths      []string
+	Infos      []os.FileInfo
+	References []bool
+	Symlinked  []bool
+	Size       int64
+	Digest     string
+	Algorithm  string
+	Probable   bool
+}
+
+type bySizeAndFirstPath []Group
 
 func (a bySizeAndFirstPath) Len() int      { return len(a) }
 func (a bySizeAndFirstPath) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
 func (a bySizeAndFirstPath) Less(i, j int) bool {
-	s1 := utils.FileSize(a[i][0])
-	s2 := utils.FileSize(a[j][0])
+	s1 := a[i].Size
+	s2 := a[j].Size
 	if s1 < s2 {
 		return true
 	}
 	if s1 > s2 {
 		return false
 	}
-	return a[i][0] < a[j][0]
+	return a[i].Paths[0] < a[j].Paths[0]
+}
+
+func (t *tracker) Groups() []Group {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	groups := make([]Group, 0)
+	for _, g := range t.groups {
+		if g.reportable() {
+			groups = append(groups, g.export())
+		}
+	}
+	sort.Sort(bySizeAndFirstPath(groups))
+	return groups
 }
 
 func (t *tracker) Dups() [][]string {
 	dups := make([][]string, 0)
+	for _, g := range t.Groups() {
+		dups = append(dups, g.Paths)
+	}
+	return dups
+}
+
+// Links returns the sets of paths that are hard links of the same file,
+// sorted by their first path. Only the first path added of each set
+// is considered when grouping duplicates.
+func (t *tracker) Links() [][]string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	links := make([][]string, 0)
 	for _, g := range t.groups {
-		if len(g.items) > 1 {
-			paths := make([]string, 0)
-			for _, item := range g.items {
-				paths = append(paths, item.path)
+		for _, item := range g.items {
+			if len(item.links) > 0 {
+				paths := append([]string{item.path}, item.links...)
+				sort.Strings(paths)
+				links = append(links, paths)
 			}
-			sort.Sort(byPath(paths))
-			dups = append(dups, paths)
 		}
 	}
-	sort.Sort(bySizeAndFirstPath(dups))
-	return dups
+	sort.Slice(links, func(i, j int) bool { return links[i][0] < links[j][0] })
+	return links
 }
 
 func (t *tracker) SetEventListener(eventListener EventListener) {
 	t.eventListener = eventListener
 }
 
-func NewTracker() Tracker {
-	t := &tracker{}
-	t.indexBySize = make(map[int64][]*group)
-	t.eventListener = &nullEventListener{}
+type Option func(*tracker)
+
+var Options = struct {
+	Verify    Option
+	Jobs      func(n int) Option
+	Cache     func(cache DigestCache) Option
+	Lazy      func(sampling Sampling) Option
+	Resume    func(snapshot Snapshot) Option
+	Hash      func(hasher Hasher) Option
+	Reference func(dirs ...string) Option
+	Roots     func(dirs ...string) Option
+}{
+	Verify: func(t *tracker) { t.verify = true },
+	Jobs: func(n int) Option {
+		return func(t *tracker) {
+			if n > 0 {
+				t.jobs = n
+			}
+		}
+	},
+	Cache: func(cache DigestCache) Option { return func(t *tracker) { t.cache = cache } },
+	Lazy:  func(sampling Sampling) Option { return func(t *tracker) { t.sampling = &sampling } },
+	Hash:  func(hasher Hasher) Option { return func(t *tracker) { t.hasher = hasher } },
+	// Reference marks the files under the directories as reference files,
+	// such as an archive: they are grouped with their copies,
+	// but groups of reference files only are not reported
+	Reference: func(dirs ...string) Option {
+		return func(t *tracker) { t.references = newDirSet(dirs) }
+	},
+	// Roots sets the directories that are scanned entirely.
+	// DupTrees and SubTrees compare only directories at or under them,
+	// as other directories may contain files that were not added.
+	Roots: func(dirs ...string) Option {
+		return func(t *tracker) { t.roots = newDirSet(dirs) }
+	},
+	// Resume reuses the digests of the snapshot for files unchanged since,
+	// so adding them again does not read them
+	Resume: func(snapshot Snapshot) Option {
+		return func(t *tracker) {
+			t.resumed = make(map[string]SnapshotFile)
+			for _, file := range snapshot.Files {
+				t.resumed[file.Path] = file
+			}
+			t.resumedSampling = snapshot.Sampling
+			t.resumedHash = snapshot.Hash
+		}
+	},
+}
+
+func NewTracker(options ...Option) Tracker {
+	t := &tracker{jobs: 1, cache: nullCache{}, hasher: Hashers.SHA256, ctx: context.Background()}
+	t.indexBySize = make(map[int64]*sizeBucket)
+	t.byFileID = make(map[utils.FileID]*fileItem)
+	t.eventListener = NullEventListener{}
+	for _, option := range options {
+		option(t)
+	}
 	return t
 }
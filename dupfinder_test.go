@@ -7,6 +7,9 @@ import (
 	"os"
 	"reflect"
 	"github.com/janosgyerik/dupfinder/utils"
+	"strings"
+	"fmt"
+	"context"
 )
 
 var tempdir string
@@ -118,11 +121,459 @@ func deleteTempFiles() {
 	utils.PanicIfFailed(err)
 }
 
-func run(fdata []fileData) [][]string {
-	t := NewTracker()
-	t.SetEventListener(&nullEventListener{})
+func run(fdata []fileData, options ...Option) [][]string {
+	t := NewTracker(options...)
+	t.SetEventListener(NullEventListener{})
 	for _, v := range fdata {
 		t.Add(path.Join(tempdir, v.relpath))
 	}
 	return t.Dups()
 }
+
+func Test_find_no_groups_when_only_middle_differs(t *testing.T) {
+	head := strings.Repeat("h", partialSize)
+	tail := strings.Repeat("t", partialSize)
+	fdata := []fileData{
+		{"f1.txt", head + "foo" + tail},
+		{"f2.txt", head + "bar" + tail},
+		{"f3.txt", head + "foo" + tail},
+	}
+	expected := [][]string{{"f1.txt", "f3.txt"}}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	if actual := normalize(run(fdata)); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("got:\n%#v\nexpected:\n%#v", actual, expected)
+	}
+	if actual := normalize(run(fdata, Options.Verify)); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("got:\n%#v\nexpected:\n%#v", actual, expected)
+	}
+}
+
+type bytesReadCounter struct {
+	NullEventListener
+	count int
+}
+
+func (c *bytesReadCounter) BytesRead(count int) {
+	c.count += count
+}
+
+func Test_distinct_same_size_files_read_only_partially(t *testing.T) {
+	size := 10 * partialSize
+	var fdata []fileData
+	for _, c := range "abcdefghij" {
+		fdata = append(fdata, fileData{string(c) + ".txt", strings.Repeat(string(c), size)})
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	tracker := NewTracker()
+	counter := &bytesReadCounter{}
+	tracker.SetEventListener(counter)
+	for _, v := range fdata {
+		tracker.Add(path.Join(tempdir, v.relpath))
+	}
+
+	if expected := len(fdata) * 2 * partialSize; counter.count != expected {
+		t.Fatalf("got %d bytes read; expected %d", counter.count, expected)
+	}
+}
+
+func Test_unique_sizes_are_not_read(t *testing.T) {
+	fdata := []fileData{
+		{"f1.txt", "a"},
+		{"f2.txt", "bb"},
+		{"f3.txt", "ccc"},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	tracker := NewTracker()
+	counter := &bytesReadCounter{}
+	tracker.SetEventListener(counter)
+	for _, v := range fdata {
+		tracker.Add(path.Join(tempdir, v.relpath))
+	}
+
+	if counter.count != 0 {
+		t.Fatalf("got %d bytes read; expected 0", counter.count)
+	}
+}
+
+func Test_Add_nonexistent_returns_error(t *testing.T) {
+	createTempFiles(nil)
+	defer deleteTempFiles()
+
+	nonexistent := path.Join(tempdir, "nonexistent")
+	err := NewTracker().Add(nonexistent)
+	if pathError, ok := err.(*os.PathError); !ok || pathError.Path != nonexistent {
+		t.Fatalf("got %#v; expected *os.PathError for %s", err, nonexistent)
+	}
+}
+
+func Test_Add_vanished_file_is_dropped(t *testing.T) {
+	fdata := []fileData{
+		{"f1.txt", "foo"},
+		{"f2.txt", "foo"},
+		{"f3.txt", "foo"},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	tracker := NewTracker()
+	f1 := path.Join(tempdir, "f1.txt")
+	if err := tracker.Add(f1); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(f1)
+
+	err := tracker.Add(path.Join(tempdir, "f2.txt"))
+	if pathError, ok := err.(*os.PathError); !ok || pathError.Path != f1 {
+		t.Fatalf("got %#v; expected *os.PathError for %s", err, f1)
+	}
+	if err := tracker.Add(path.Join(tempdir, "f3.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]string{{"f2.txt", "f3.txt"}}
+	if actual := normalize(tracker.Dups()); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("got:\n%#v\nexpected:\n%#v", actual, expected)
+	}
+}
+
+func Test_AddAll_same_result_regardless_of_jobs(t *testing.T) {
+	head := strings.Repeat("h", partialSize)
+	tail := strings.Repeat("t", partialSize)
+	fdata := []fileData{
+		{"z1.txt", "zo"},
+		{"z2.txt", "zo"},
+		{"size5-1.txt", "apple"},
+		{"size5-2.txt", "apple"},
+		{"f1.txt", "foo"},
+		{"a/f2.txt", "foo"},
+		{"b/f1.txt", "bar"},
+		{"b/c/f2.txt", "bar"},
+		{"c/f1.txt", "baz"},
+		{"m1.txt", head + "foo" + tail},
+		{"m2.txt", head + "bar" + tail},
+		{"m3.txt", head + "foo" + tail},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	expected := run(fdata)
+
+	for _, jobs := range []int{1, 2, 8} {
+		tracker := NewTracker(Options.Jobs(jobs))
+		paths := make(chan string)
+		go func() {
+			for _, v := range fdata {
+				paths <- path.Join(tempdir, v.relpath)
+			}
+			paths <- path.Join(tempdir, "nonexistent")
+			close(paths)
+		}()
+
+		errs := tracker.AddAll(paths)
+		if len(errs) != 1 {
+			t.Errorf("jobs=%d: got errors %v; expected 1 error", jobs, errs)
+		}
+		if actual := tracker.Dups(); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("jobs=%d: got:\n%#v\nexpected:\n%#v", jobs, actual, expected)
+		}
+	}
+}
+
+type mapCache map[string][2]string
+
+func (c mapCache) Get(path string, info os.FileInfo, hash string) (string, string, bool) {
+	digests, ok := c[hash+":"+path]
+	return digests[0], digests[1], ok
+}
+
+func (c mapCache) Put(path string, info os.FileInfo, hash, partial, full string) {
+	c[hash+":"+path] = [2]string{partial, full}
+}
+
+func Test_cached_digests_are_not_recomputed(t *testing.T) {
+	head := strings.Repeat("h", partialSize)
+	tail := strings.Repeat("t", partialSize)
+	fdata := []fileData{
+		{"f1.txt", head + "foo" + tail},
+		{"f2.txt", head + "bar" + tail},
+		{"f3.txt", head + "foo" + tail},
+	}
+	expected := [][]string{{"f1.txt", "f3.txt"}}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	cache := mapCache{}
+	for i, expectedRead := range []bool{true, false} {
+		tracker := NewTracker(Options.Cache(cache))
+		counter := &bytesReadCounter{}
+		tracker.SetEventListener(counter)
+		for _, v := range fdata {
+			tracker.Add(path.Join(tempdir, v.relpath))
+		}
+
+		if actual := normalize(tracker.Dups()); !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("run %d: got:\n%#v\nexpected:\n%#v", i, actual, expected)
+		}
+		if read := counter.count > 0; read != expectedRead {
+			t.Fatalf("run %d: got %d bytes read", i, counter.count)
+		}
+	}
+}
+
+func Test_Groups_include_sha256_digest_and_infos(t *testing.T) {
+	fdata := []fileData{
+		{"f2.txt", "foo"},
+		{"f1.txt", "foo"},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	tracker := NewTracker()
+	for _, v := range fdata {
+		tracker.Add(path.Join(tempdir, v.relpath))
+	}
+
+	groups := tracker.Groups()
+	if len(groups) != 1 {
+		t.Fatalf("got %d groups; expected 1", len(groups))
+	}
+
+	g := groups[0]
+	if expected := "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"; g.Digest != expected {
+		t.Errorf("got digest %s; expected %s", g.Digest, expected)
+	}
+	for i, p := range g.Paths {
+		if g.Infos[i].Name() != path.Base(p) {
+			t.Errorf("got info of %s for path %s", g.Infos[i].Name(), p)
+		}
+	}
+}
+
+func Test_hard_links_are_reported_separately_and_not_read(t *testing.T) {
+	content := strings.Repeat("x", 3*partialSize)
+	fdata := []fileData{
+		{"f1.txt", content},
+		{"f3.txt", content},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	f1 := path.Join(tempdir, "f1.txt")
+	f2 := path.Join(tempdir, "f2.txt")
+	utils.PanicIfFailed(os.Link(f1, f2))
+	paths := []string{f1, f2, path.Join(tempdir, "f3.txt")}
+
+	for _, jobs := range []int{0, 2} {
+		tracker := NewTracker(Options.Jobs(jobs))
+		counter := &bytesReadCounter{}
+		tracker.SetEventListener(counter)
+		if jobs == 0 {
+			for _, p := range paths {
+				utils.PanicIfFailed(tracker.Add(p))
+			}
+		} else {
+			ch := make(chan string, len(paths))
+			for _, p := range paths {
+				ch <- p
+			}
+			close(ch)
+			if errs := tracker.AddAll(ch); len(errs) > 0 {
+				t.Fatal(errs)
+			}
+		}
+
+		expected := [][]string{{"f1.txt", "f3.txt"}}
+		if actual := normalize(tracker.Dups()); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("jobs=%d: got:\n%#v\nexpected:\n%#v", jobs, actual, expected)
+		}
+		expectedLinks := [][]string{{"f1.txt", "f2.txt"}}
+		if actual := normalize(tracker.Links()); !reflect.DeepEqual(expectedLinks, actual) {
+			t.Errorf("jobs=%d: got links:\n%#v\nexpected:\n%#v", jobs, actual, expectedLinks)
+		}
+		// partial and full digests of f1 and f3 only
+		if expected := 2 * (2*partialSize + len(content)); counter.count != expected {
+			t.Errorf("jobs=%d: got %d bytes read; expected %d", jobs, counter.count, expected)
+		}
+	}
+}
+
+func Test_followed_symlinks_are_not_reported_as_hard_links(t *testing.T) {
+	fdata := []fileData{
+		{"f1.txt", "foo"},
+		{"f2.txt", "foo"},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	f1 := path.Join(tempdir, "f1.txt")
+	link := path.Join(tempdir, "link")
+	utils.PanicIfFailed(os.Symlink("f1.txt", link))
+
+	// the link first, replaced by the file once it is found
+	for _, paths := range [][]string{{f1, link, path.Join(tempdir, "f2.txt")}, {link, f1, path.Join(tempdir, "f2.txt")}} {
+		tracker := NewTracker()
+		for _, p := range paths {
+			utils.PanicIfFailed(tracker.Add(p))
+		}
+
+		expected := [][]string{{"f1.txt", "f2.txt"}}
+		if actual := normalize(tracker.Dups()); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("got:\n%#v\nexpected:\n%#v", actual, expected)
+		}
+		if links := tracker.Links(); len(links) != 0 {
+			t.Errorf("got links %v; expected none", links)
+		}
+		if report := tracker.Report(); report.Linked != 0 || report.LinkedBytes != 0 {
+			t.Errorf("got %d linked paths of %d bytes; expected none", report.Linked, report.LinkedBytes)
+		}
+		group := tracker.Groups()[0]
+		if !group.IsSymlinked(0) || group.IsSymlinked(1) {
+			t.Errorf("got symlinked %v; expected only f1.txt", group.Symlinked)
+		}
+	}
+}
+
+type recordingListener struct {
+	NullEventListener
+	events []string
+}
+
+func (l *recordingListener) GroupCreated(event GroupEvent) {
+	l.events = append(l.events, fmt.Sprintf("created %d %s %d %v", event.ID, path.Base(event.Path), event.Size, len(event.Paths)))
+}
+
+func (l *recordingListener) GroupGrew(event GroupEvent) {
+	l.events = append(l.events, fmt.Sprintf("grew %d %s %d %v", event.ID, path.Base(event.Path), event.Size, len(event.Paths)))
+}
+
+func (l *recordingListener) FileSkipped(p string, err error) {
+	l.events = append(l.events, "skipped "+path.Base(p))
+}
+
+func (l *recordingListener) PhaseChanged(phase Phase, files int, bytes int64) {
+	l.events = append(l.events, fmt.Sprintf("phase %s %d %d", phase, files, bytes))
+}
+
+func Test_events(t *testing.T) {
+	fdata := []fileData{
+		{"f1.txt", "foo"},
+		{"f2.txt", "bar"},
+		{"f3.txt", "foo"},
+		{"f4.txt", "foo"},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	tracker := NewTracker()
+	listener := &recordingListener{}
+	tracker.SetEventListener(listener)
+
+	paths := make(chan string, len(fdata)+1)
+	for _, v := range fdata {
+		paths <- path.Join(tempdir, v.relpath)
+	}
+	paths <- path.Join(tempdir, "nonexistent")
+	close(paths)
+	tracker.AddAll(paths)
+
+	expected := []string{
+		"phase stat 5 0",
+		"skipped nonexistent",
+		"phase partial-digest 4 12",
+		"phase full-digest 0 0",
+		"phase grouping 4 0",
+		"created 1 f3.txt 3 2",
+		"grew 1 f4.txt 3 3",
+		"phase done 0 0",
+	}
+	if !reflect.DeepEqual(expected, listener.events) {
+		t.Errorf("got:\n%#v\nexpected:\n%#v", listener.events, expected)
+	}
+
+	groups := tracker.Groups()
+	if len(groups) != 1 || groups[0].ID != 1 {
+		t.Errorf("got groups %#v; expected one with ID 1", groups)
+	}
+}
+
+// cancellingListener cancels the context when the given phase starts
+type cancellingListener struct {
+	recordingListener
+	phase  Phase
+	cancel context.CancelFunc
+}
+
+func (l *cancellingListener) PhaseChanged(phase Phase, files int, bytes int64) {
+	if phase == l.phase {
+		l.cancel()
+	}
+}
+
+func Test_AddAllContext_cancelled_keeps_partial_results(t *testing.T) {
+	head := strings.Repeat("h", partialSize)
+	tail := strings.Repeat("t", partialSize)
+	fdata := []fileData{
+		{"big1.txt", head + "foo" + tail},
+		{"big2.txt", head + "foo" + tail},
+		{"small1.txt", "foo"},
+		{"small2.txt", "foo"},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tracker := NewTracker(Options.Jobs(2))
+	listener := &cancellingListener{phase: PhaseFullDigest, cancel: cancel}
+	tracker.SetEventListener(listener)
+
+	paths := make(chan string, len(fdata))
+	for _, v := range fdata {
+		paths <- path.Join(tempdir, v.relpath)
+	}
+	close(paths)
+
+	errs := tracker.AddAllContext(ctx, paths)
+	if len(errs) != 1 || errs[0] != context.Canceled {
+		t.Errorf("got errors %v; expected only %v", errs, context.Canceled)
+	}
+
+	expected := [][]string{{"small1.txt", "small2.txt"}}
+	if actual := normalize(tracker.Dups()); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("got:\n%#v\nexpected:\n%#v", actual, expected)
+	}
+	for _, event := range listener.events {
+		if strings.HasPrefix(event, "skipped") {
+			t.Errorf("unexpected event: %s", event)
+		}
+	}
+
+	// the tracker is still usable, the file not added is grouped on the next try
+	if err := tracker.Add(path.Join(tempdir, "big2.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if actual := tracker.Dups(); len(actual) != 2 {
+		t.Errorf("got %d groups; expected 2", len(actual))
+	}
+	if links := tracker.Links(); len(links) != 0 {
+		t.Errorf("got links %v; expected none", links)
+	}
+}
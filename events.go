@@ -0,0 +1,102 @@
+package dupfinder
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+)
+
+// GroupEvent describes a group of duplicates when a file joins it.
+// ID identifies the group for the lifetime of the tracker, same as Group.ID.
+// Paths is a copy of all the paths of the group, including the new Path.
+type GroupEvent struct {
+	ID        int
+	Path      string
+	Paths     []string
+	Size      int64
+	Digest    string
+	Algorithm string
+	Probable  bool
+}
+
+// Phase is a stage of adding files with Tracker.AddAll
+type Phase int
+
+const (
+	PhaseStat Phase = iota
+	PhasePartialDigest
+	PhaseFullDigest
+	PhaseGrouping
+	PhaseDone
+)
+
+var phaseNames = []string{"stat", "partial-digest", "full-digest", "grouping", "done"}
+
+func (phase Phase) String() string {
+	return phaseNames[phase]
+}
+
+// NullEventListener ignores all events. Embed it to handle only some events.
+type NullEventListener struct{}
+
+func (listener NullEventListener) GroupCreated(GroupEvent) {}
+
+func (listener NullEventListener) GroupGrew(GroupEvent) {}
+
+func (listener NullEventListener) FileSkipped(string, error) {}
+
+func (listener NullEventListener) PhaseChanged(Phase, int, int64) {}
+
+func (listener NullEventListener) FileStarted(string) {}
+
+func (listener NullEventListener) BytesRead(int) {}
+
+func (g *group) event(path string) GroupEvent {
+	event := GroupEvent{
+		ID:       g.id,
+		Path:     path,
+		Paths:    append([]string(nil), g.paths...),
+		Size:     g.items[0].size,
+		Probable: g.probable,
+	}
+	if !g.probable {
+		event.Digest = hex.EncodeToString([]byte(g.items[0].full))
+		event.Algorithm = g.tracker.hasher.Name()
+	}
+	return event
+}
+
+// emit calls the event listener,
+// which thus never gets called from multiple workers at the same time
+func (t *tracker) emit(fn func(listener EventListener)) {
+	t.listenerMutex.Lock()
+	defer t.listenerMutex.Unlock()
+	fn(t.eventListener)
+}
+
+// skipped reports the files of the errors as skipped, and returns the errors,
+// except the ones caused by the context being done
+func (t *tracker) skipped(errs ...error) []error {
+	var kept []error
+	for _, err := range errs {
+		if t.cancelled(err) {
+			continue
+		}
+		kept = append(kept, err)
+		path := ""
+		var pathError *os.PathError
+		if errors.As(err, &pathError) {
+			path = pathError.Path
+		}
+		t.emit(func(listener EventListener) { listener.FileSkipped(path, err) })
+	}
+	return kept
+}
+
+func (t *tracker) phaseChanged(phase Phase, files int, bytes int64) {
+	t.emit(func(listener EventListener) { listener.PhaseChanged(phase, files, bytes) })
+}
+
+func (t *tracker) fileStarted(path string) {
+	t.emit(func(listener EventListener) { listener.FileStarted(path) })
+}
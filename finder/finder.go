@@ -4,6 +4,12 @@ import (
 	"path/filepath"
 	"os"
 	"regexp"
+	"strings"
+	"github.com/janosgyerik/dupfinder/utils"
+	"fmt"
+	"io/ioutil"
+	"time"
+	"context"
 )
 
 type Filter interface {
@@ -18,6 +24,14 @@ func (filter minSizeFilter) Accept(path string, info os.FileInfo) bool {
 	return info.Size() >= filter.size
 }
 
+type maxSizeFilter struct {
+	size int64
+}
+
+func (filter maxSizeFilter) Accept(path string, info os.FileInfo) bool {
+	return info.Size() <= filter.size
+}
+
 type regexFilter struct {
 	regex    *regexp.Regexp
 	negative bool
@@ -32,47 +46,415 @@ func newRegexFilter(regex string, negative bool) regexFilter {
 	return regexFilter{regexp.MustCompile(regex), negative}
 }
 
+// pathRegexFilter matches the regex against the full path, not only the filename
+type pathRegexFilter struct {
+	regex *regexp.Regexp
+}
+
+func (filter pathRegexFilter) Accept(path string, info os.FileInfo) bool {
+	return filter.regex.MatchString(path)
+}
+
+type globFilter struct {
+	pattern string
+}
+
+func (filter globFilter) Accept(path string, info os.FileInfo) bool {
+	matched, _ := filepath.Match(filter.pattern, filepath.Base(path))
+	return matched
+}
+
+type extensionsFilter struct {
+	extensions map[string]bool
+}
+
+func (filter extensionsFilter) Accept(path string, info os.FileInfo) bool {
+	return filter.extensions[strings.ToLower(filepath.Ext(path))]
+}
+
+func newExtensionsFilter(extensions ...string) extensionsFilter {
+	filter := extensionsFilter{make(map[string]bool)}
+	for _, ext := range extensions {
+		filter.extensions["."+strings.ToLower(strings.TrimPrefix(ext, "."))] = true
+	}
+	return filter
+}
+
+type modTimeFilter struct {
+	time  time.Time
+	newer bool
+}
+
+func (filter modTimeFilter) Accept(path string, info os.FileInfo) bool {
+	if filter.newer {
+		return info.ModTime().After(filter.time)
+	}
+	return info.ModTime().Before(filter.time)
+}
+
+// ownerFilter rejects all files where owners are not supported
+type ownerFilter struct {
+	id    int
+	group bool
+}
+
+func (filter ownerFilter) Accept(path string, info os.FileInfo) bool {
+	owner, ok := utils.OwnerOf(info)
+	if !ok {
+		return false
+	}
+	if filter.group {
+		return owner.Gid == filter.id
+	}
+	return owner.Uid == filter.id
+}
+
+// permFilter accepts files that have all the given permission bits set
+type permFilter struct {
+	perm os.FileMode
+}
+
+func (filter permFilter) Accept(path string, info os.FileInfo) bool {
+	return info.Mode().Perm()&filter.perm == filter.perm
+}
+
+type andFilter []Filter
+
+func (filters andFilter) Accept(path string, info os.FileInfo) bool {
+	for _, filter := range filters {
+		if !filter.Accept(path, info) {
+			return false
+		}
+	}
+	return true
+}
+
+type orFilter []Filter
+
+func (filters orFilter) Accept(path string, info os.FileInfo) bool {
+	for _, filter := range filters {
+		if filter.Accept(path, info) {
+			return true
+		}
+	}
+	return false
+}
+
+type notFilter struct {
+	filter Filter
+}
+
+func (filter notFilter) Accept(path string, info os.FileInfo) bool {
+	return !filter.filter.Accept(path, info)
+}
+
+// DirFilter is a Filter that also decides which directories under root
+// the walk descends into. Rejected directories are pruned entirely.
+type DirFilter interface {
+	Filter
+	AcceptDir(root, path string, info os.FileInfo) bool
+}
+
+// dirOnly implements Filter for filters that do not restrict files
+type dirOnly struct{}
+
+func (filter dirOnly) Accept(path string, info os.FileInfo) bool {
+	return true
+}
+
+type dirRegexFilter struct {
+	dirOnly
+	regex regexFilter
+}
+
+func (filter dirRegexFilter) AcceptDir(root, path string, info os.FileInfo) bool {
+	return filter.regex.Accept(path, info)
+}
+
+// maxDepthFilter limits how many directory levels below root to descend
+type maxDepthFilter struct {
+	dirOnly
+	depth int
+}
+
+func depth(root, path string) int {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+func (filter maxDepthFilter) AcceptDir(root, path string, info os.FileInfo) bool {
+	return depth(root, path) <= filter.depth
+}
+
+type oneFileSystemFilter struct {
+	dirOnly
+}
+
+func (filter oneFileSystemFilter) AcceptDir(root, path string, info os.FileInfo) bool {
+	rootInfo, err := os.Stat(root)
+	if err != nil {
+		return false
+	}
+	rootID, ok1 := utils.FileIDOf(rootInfo)
+	id, ok2 := utils.FileIDOf(info)
+	if !ok1 || !ok2 {
+		return true
+	}
+	return rootID.Device == id.Device
+}
+
+type filterByInt func(n int) Filter
 type filterByInt64 func(n int64) Filter
 type filterByString func(s string) Filter
+type filterByStrings func(s ...string) Filter
+type filterByTime func(t time.Time) Filter
+type filterByFileMode func(mode os.FileMode) Filter
+type filterByFilters func(filters ...Filter) Filter
 
+// Filters are the available filters. Glob patterns and extensions match
+// the filename, PathRegex the full path. And, Or and Not combine filters
+// on files only: directories are pruned by DirFilters given to NewFinder directly.
 var Filters = struct {
-	MinSize      filterByInt64
-	IncludeRegex filterByString
-	ExcludeRegex filterByString
+	MinSize         filterByInt64
+	MaxSize         filterByInt64
+	IncludeRegex    filterByString
+	ExcludeRegex    filterByString
+	PathRegex       filterByString
+	Glob            filterByString
+	Extensions      filterByStrings
+	NewerThan       filterByTime
+	OlderThan       filterByTime
+	Owner           filterByInt
+	Group           filterByInt
+	Perm            filterByFileMode
+	And             filterByFilters
+	Or              filterByFilters
+	Not             func(filter Filter) Filter
+	ExcludeDirRegex filterByString
+	MaxDepth        filterByInt
+	OneFileSystem   Filter
 }{
-	MinSize:      func(size int64) Filter { return minSizeFilter{size} },
-	IncludeRegex: func(regex string) Filter { return newRegexFilter(regex, false) },
-	ExcludeRegex: func(regex string) Filter { return newRegexFilter(regex, true) },
+	MinSize:         func(size int64) Filter { return minSizeFilter{size} },
+	MaxSize:         func(size int64) Filter { return maxSizeFilter{size} },
+	IncludeRegex:    func(regex string) Filter { return newRegexFilter(regex, false) },
+	ExcludeRegex:    func(regex string) Filter { return newRegexFilter(regex, true) },
+	PathRegex:       func(regex string) Filter { return pathRegexFilter{regexp.MustCompile(regex)} },
+	Glob:            func(pattern string) Filter { return globFilter{pattern} },
+	Extensions:      func(extensions ...string) Filter { return newExtensionsFilter(extensions...) },
+	NewerThan:       func(t time.Time) Filter { return modTimeFilter{t, true} },
+	OlderThan:       func(t time.Time) Filter { return modTimeFilter{t, false} },
+	Owner:           func(uid int) Filter { return ownerFilter{id: uid} },
+	Group:           func(gid int) Filter { return ownerFilter{id: gid, group: true} },
+	Perm:            func(perm os.FileMode) Filter { return permFilter{perm.Perm()} },
+	And:             func(filters ...Filter) Filter { return andFilter(filters) },
+	Or:              func(filters ...Filter) Filter { return orFilter(filters) },
+	Not:             func(filter Filter) Filter { return notFilter{filter} },
+	ExcludeDirRegex: func(regex string) Filter { return dirRegexFilter{regex: newRegexFilter(regex, true)} },
+	MaxDepth:        func(depth int) Filter { return maxDepthFilter{depth: depth} },
+	OneFileSystem:   oneFileSystemFilter{},
 }
 
+type ErrorHandler func(path string, err error)
+
+// SymlinkPolicy decides which symbolic links are followed
+type SymlinkPolicy int
+
+const (
+	// FollowNever ignores symbolic links
+	FollowNever SymlinkPolicy = iota
+	// FollowFiles includes symbolic links to regular files
+	FollowFiles
+	// FollowAll also descends into symbolic links to directories
+	FollowAll
+)
+
+var symlinkPolicyNames = []string{"never", "files", "all"}
+
+func (policy SymlinkPolicy) String() string {
+	return symlinkPolicyNames[policy]
+}
+
+func ParseSymlinkPolicy(s string) (SymlinkPolicy, error) {
+	for i, name := range symlinkPolicyNames {
+		if name == s {
+			return SymlinkPolicy(i), nil
+		}
+	}
+	return FollowNever, fmt.Errorf("invalid symlink policy: %q", s)
+}
+
+// IsFile reports whether path is a regular file,
+// or a symbolic link to one that the policy follows
+func IsFile(path string, policy SymlinkPolicy) bool {
+	if policy == FollowNever {
+		return utils.IsFile(path)
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// Finder walks directory trees and sends the paths of regular files
+// accepted by all filters, skipping directories rejected by a DirFilter.
+// Symbolic links are followed according to the symlink policy,
+// FollowNever by default. Directories reached again through a symbolic link
+// are not walked twice, so loops of links cannot make the walk endless.
+// Files and directories matching the patterns of IgnoreFileName files
+// in their directory or above are skipped, as well as the patterns of
+// the ignore file set by SetIgnoreFile, relative to the walked directory.
+// Paths that cannot be visited are reported to the error handler,
+// and the walk carries on. FindContext stops the walk and closes the channel
+// when the context is done, so consumers may stop reading at any time.
 type Finder interface {
 	Find(basedir string) <-chan string
+	FindContext(ctx context.Context, basedir string) <-chan string
+	SetErrorHandler(ErrorHandler)
+	SetSymlinkPolicy(SymlinkPolicy)
+	SetIgnoreFile(path string) error
 }
 
 type defaultFinder struct {
-	filters []Filter
+	filters      []Filter
+	dirFilters   []DirFilter
+	errorHandler ErrorHandler
+	symlinks     SymlinkPolicy
+	ignoreFile   *ignoreList
+}
+
+// walk is the state of a single call of Find
+type walk struct {
+	ctx     context.Context
+	finder  *defaultFinder
+	root    string
+	paths   chan<- string
+	visited map[utils.FileID]bool
+	ignores []*ignoreList
 }
 
-func (finder defaultFinder) Find(basedir string) <-chan string {
+func (finder *defaultFinder) Find(basedir string) <-chan string {
+	return finder.FindContext(context.Background(), basedir)
+}
+
+func (finder *defaultFinder) FindContext(ctx context.Context, basedir string) <-chan string {
 	paths := make(chan string)
-	walkfn := func(path string, info os.FileInfo, err error) error {
-		for _, filter := range finder.filters {
-			if !filter.Accept(path, info) {
-				return nil
-			}
+	go func() {
+		w := &walk{ctx: ctx, finder: finder, root: basedir, paths: paths, visited: make(map[utils.FileID]bool)}
+		if finder.ignoreFile != nil {
+			w.ignores = append(w.ignores, &ignoreList{base: basedir, patterns: finder.ignoreFile.patterns})
 		}
-		if info.Mode().IsRegular() {
-			paths <- path
+		if info, err := os.Lstat(basedir); err != nil {
+			finder.errorHandler(basedir, err)
+		} else {
+			w.visit(basedir, info)
 		}
-		return nil
-	}
-	go func() {
-		filepath.Walk(basedir, walkfn)
 		close(paths)
 	}()
 	return paths
 }
 
+func (w *walk) visit(path string, info os.FileInfo) {
+	if info.Mode()&os.ModeSymlink != 0 {
+		if w.finder.symlinks == FollowNever {
+			return
+		}
+		target, err := os.Stat(path)
+		if err != nil {
+			w.finder.errorHandler(path, err)
+			return
+		}
+		if target.IsDir() && w.finder.symlinks != FollowAll {
+			return
+		}
+		info = target
+	}
+
+	if path != w.root && isIgnored(w.ignores, path, info.IsDir()) {
+		return
+	}
+
+	if info.IsDir() {
+		w.visitDir(path, info)
+		return
+	}
+	if !info.Mode().IsRegular() {
+		return
+	}
+	for _, filter := range w.finder.filters {
+		if !filter.Accept(path, info) {
+			return
+		}
+	}
+	select {
+	case w.paths <- path:
+	case <-w.ctx.Done():
+	}
+}
+
+func (w *walk) visitDir(path string, info os.FileInfo) {
+	if path != w.root {
+		for _, filter := range w.finder.dirFilters {
+			if !filter.AcceptDir(w.root, path, info) {
+				return
+			}
+		}
+	}
+
+	if id, ok := utils.FileIDOf(info); ok {
+		if w.visited[id] {
+			return
+		}
+		w.visited[id] = true
+	}
+
+	ignoreFile := filepath.Join(path, IgnoreFileName)
+	if list, err := readIgnoreFile(ignoreFile, path); err == nil {
+		w.ignores = append(w.ignores, list)
+		defer func() { w.ignores = w.ignores[:len(w.ignores)-1] }()
+	} else if !os.IsNotExist(err) {
+		w.finder.errorHandler(ignoreFile, err)
+	}
+
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		w.finder.errorHandler(path, err)
+	}
+	for _, entry := range entries {
+		if w.ctx.Err() != nil {
+			return
+		}
+		w.visit(filepath.Join(path, entry.Name()), entry)
+	}
+}
+
+func (finder *defaultFinder) SetErrorHandler(errorHandler ErrorHandler) {
+	finder.errorHandler = errorHandler
+}
+
+// SetIgnoreFile reads patterns to ignore in every walk, from a file
+// in gitignore syntax
+func (finder *defaultFinder) SetIgnoreFile(path string) error {
+	list, err := readIgnoreFile(path, "")
+	if err != nil {
+		return err
+	}
+	finder.ignoreFile = list
+	return nil
+}
+
+func (finder *defaultFinder) SetSymlinkPolicy(policy SymlinkPolicy) {
+	finder.symlinks = policy
+}
+
+func ignoreError(string, error) {}
+
 func NewFinder(filters ... Filter) Finder {
-	return defaultFinder{filters: filters}
+	finder := &defaultFinder{filters: filters, errorHandler: ignoreError}
+	for _, filter := range filters {
+		if dirFilter, ok := filter.(DirFilter); ok {
+			finder.dirFilters = append(finder.dirFilters, dirFilter)
+		}
+	}
+	return finder
 }
@@ -7,6 +7,8 @@ import (
 	"reflect"
 	"path"
 	"github.com/janosgyerik/dupfinder/utils"
+	"time"
+	"context"
 )
 
 var tempdir string
@@ -139,3 +141,226 @@ func findPaths(finder Finder) []string {
 	}
 	return paths
 }
+
+func Test_Find_reports_errors(t *testing.T) {
+	createTempFiles([]fileData{{relpath: "f1.txt"}})
+	defer deleteTempFiles()
+
+	nonexistent := path.Join(tempdir, "nonexistent")
+
+	var errorPaths []string
+	finder := NewFinder()
+	finder.SetErrorHandler(func(path string, err error) {
+		errorPaths = append(errorPaths, path)
+	})
+
+	var paths []string
+	for p := range finder.Find(nonexistent) {
+		paths = append(paths, p)
+	}
+
+	if paths != nil {
+		t.Errorf("got %#v; expected no paths", paths)
+	}
+	if expected := []string{nonexistent}; !reflect.DeepEqual(expected, errorPaths) {
+		t.Errorf("got %#v; expected %#v", errorPaths, expected)
+	}
+}
+
+func Test_Find_ExcludeDirRegex(t *testing.T) {
+	fdata := []fileData{
+		{relpath: "f1.txt"},
+		{relpath: ".git/f2.txt"},
+		{relpath: "a/.git/f3.txt"},
+		{relpath: "a/node_modules/b/f4.txt"},
+		{relpath: "a/b/f5.txt"},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	data := []struct {
+		pattern  string
+		expected []string
+	}{
+		{pattern: `^\.git$`, expected: []string{"a/b/f5.txt", "a/node_modules/b/f4.txt", "f1.txt"}},
+		{pattern: `^(\.git|node_modules)$`, expected: []string{"a/b/f5.txt", "f1.txt"}},
+		{pattern: `^b$`, expected: []string{".git/f2.txt", "a/.git/f3.txt", "f1.txt"}},
+	}
+
+	for _, item := range data {
+		finder := NewFinder(Filters.ExcludeDirRegex(item.pattern))
+		actual := normalize(findPaths(finder))
+		if !reflect.DeepEqual(item.expected, actual) {
+			t.Errorf("got %#v; expected %#v", actual, item.expected)
+		}
+	}
+}
+
+func Test_Find_MaxDepth(t *testing.T) {
+	fdata := []fileData{
+		{relpath: "f1.txt"},
+		{relpath: "a/f2.txt"},
+		{relpath: "a/b/f3.txt"},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	data := []struct {
+		depth    int
+		expected []string
+	}{
+		{depth: 0, expected: []string{"f1.txt"}},
+		{depth: 1, expected: []string{"a/f2.txt", "f1.txt"}},
+		{depth: 2, expected: []string{"a/b/f3.txt", "a/f2.txt", "f1.txt"}},
+	}
+
+	for _, item := range data {
+		finder := NewFinder(Filters.MaxDepth(item.depth))
+		actual := normalize(findPaths(finder))
+		if !reflect.DeepEqual(item.expected, actual) {
+			t.Errorf("depth %d: got %#v; expected %#v", item.depth, actual, item.expected)
+		}
+	}
+}
+
+func Test_Find_OneFileSystem_same_device(t *testing.T) {
+	fdata := []fileData{
+		{relpath: "f1.txt"},
+		{relpath: "a/f2.txt"},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	expected := []string{"a/f2.txt", "f1.txt"}
+	actual := normalize(findPaths(NewFinder(Filters.OneFileSystem)))
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("got %#v; expected %#v", actual, expected)
+	}
+}
+
+func Test_Find_SymlinkPolicy(t *testing.T) {
+	fdata := []fileData{
+		{relpath: "a/f1.txt"},
+		{relpath: "b/f2.txt"},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	utils.PanicIfFailed(os.Symlink(path.Join(tempdir, "a/f1.txt"), path.Join(tempdir, "link.txt")))
+	utils.PanicIfFailed(os.Symlink(path.Join(tempdir, "b"), path.Join(tempdir, "a/linked-dir")))
+	// loops back to the root
+	utils.PanicIfFailed(os.Symlink(tempdir, path.Join(tempdir, "b/loop")))
+	utils.PanicIfFailed(os.Symlink(path.Join(tempdir, "nonexistent"), path.Join(tempdir, "broken")))
+
+	data := []struct {
+		policy   SymlinkPolicy
+		expected []string
+		errors   int
+	}{
+		{policy: FollowNever, expected: []string{"a/f1.txt", "b/f2.txt"}},
+		{policy: FollowFiles, expected: []string{"a/f1.txt", "b/f2.txt", "link.txt"}, errors: 1},
+		{policy: FollowAll, expected: []string{"a/f1.txt", "a/linked-dir/f2.txt", "link.txt"}, errors: 1},
+	}
+
+	for _, item := range data {
+		finder := NewFinder()
+		finder.SetSymlinkPolicy(item.policy)
+		errors := 0
+		finder.SetErrorHandler(func(string, error) { errors++ })
+
+		actual := normalize(findPaths(finder))
+		if !reflect.DeepEqual(item.expected, actual) {
+			t.Errorf("%v: got %#v; expected %#v", item.policy, actual, item.expected)
+		}
+		if errors != item.errors {
+			t.Errorf("%v: got %d errors; expected %d", item.policy, errors, item.errors)
+		}
+	}
+}
+
+func Test_ParseSymlinkPolicy(t *testing.T) {
+	for _, policy := range []SymlinkPolicy{FollowNever, FollowFiles, FollowAll} {
+		if parsed, err := ParseSymlinkPolicy(policy.String()); err != nil || parsed != policy {
+			t.Errorf("got %v, %v; expected %v", parsed, err, policy)
+		}
+	}
+	if _, err := ParseSymlinkPolicy("sometimes"); err == nil {
+		t.Error("expected error for invalid policy")
+	}
+}
+
+func Test_Find_more_filters(t *testing.T) {
+	fdata := []fileData{
+		{"a/f1.txt", 1},
+		{"a/f2.JPG", 2},
+		{"b/f3.jpg", 3},
+		{"b/f4.png", 4},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	old := time.Now().Add(-48 * time.Hour)
+	utils.PanicIfFailed(os.Chtimes(path.Join(tempdir, "a/f1.txt"), old, old))
+	utils.PanicIfFailed(os.Chmod(path.Join(tempdir, "b/f4.png"), 0755))
+	dayAgo := time.Now().Add(-24 * time.Hour)
+
+	data := []struct {
+		name     string
+		filter   Filter
+		expected []string
+	}{
+		{"MaxSize", Filters.MaxSize(2), []string{"a/f1.txt", "a/f2.JPG"}},
+		{"PathRegex", Filters.PathRegex(`/b/`), []string{"b/f3.jpg", "b/f4.png"}},
+		{"Glob", Filters.Glob("f[12].*"), []string{"a/f1.txt", "a/f2.JPG"}},
+		{"Extensions", Filters.Extensions("jpg", ".png"), []string{"a/f2.JPG", "b/f3.jpg", "b/f4.png"}},
+		{"NewerThan", Filters.NewerThan(dayAgo), []string{"a/f2.JPG", "b/f3.jpg", "b/f4.png"}},
+		{"OlderThan", Filters.OlderThan(dayAgo), []string{"a/f1.txt"}},
+		{"Perm", Filters.Perm(0111), []string{"b/f4.png"}},
+		{"Owner", Filters.Owner(os.Getuid()), []string{"a/f1.txt", "a/f2.JPG", "b/f3.jpg", "b/f4.png"}},
+		{"Group", Filters.Group(os.Getgid() + 1), nil},
+		{"And", Filters.And(Filters.Extensions("jpg"), Filters.MinSize(3)), []string{"b/f3.jpg"}},
+		{"Or", Filters.Or(Filters.Glob("*.txt"), Filters.Glob("*.png")), []string{"a/f1.txt", "b/f4.png"}},
+		{"Not", Filters.Not(Filters.Extensions("jpg")), []string{"a/f1.txt", "b/f4.png"}},
+	}
+
+	for _, item := range data {
+		finder := NewFinder(item.filter)
+		actual := normalize(findPaths(finder))
+		if !reflect.DeepEqual(item.expected, actual) {
+			t.Errorf("%s: got %#v; expected %#v", item.name, actual, item.expected)
+		}
+	}
+}
+
+func Test_FindContext_stops_when_cancelled(t *testing.T) {
+	var fdata []fileData
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		fdata = append(fdata, fileData{relpath: name + "/f.txt"})
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	paths := NewFinder().FindContext(ctx, tempdir)
+	<-paths
+	cancel()
+
+	// the channel gets closed even though nobody reads the remaining paths
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-paths:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("channel not closed after cancel")
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package finder
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFileName is the name of the files listing paths to ignore
+// in the directory containing them and below, in gitignore syntax
+const IgnoreFileName = ".dupfinderignore"
+
+type ignorePattern struct {
+	regex   *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreList is the patterns of an ignore file, relative to base
+type ignoreList struct {
+	base     string
+	patterns []ignorePattern
+}
+
+// readIgnoreFile parses the ignore file at path, with patterns relative to base
+func readIgnoreFile(path, base string) (*ignoreList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	list := &ignoreList{base: base}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if pattern, ok := parseIgnorePattern(scanner.Text()); ok {
+			list.patterns = append(list.patterns, pattern)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func parseIgnorePattern(line string) (ignorePattern, bool) {
+	var pattern ignorePattern
+
+	line = strings.TrimSuffix(line, "\r")
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return pattern, false
+	}
+	if strings.HasPrefix(line, "!") {
+		pattern.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		pattern.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if line == "" {
+		return pattern, false
+	}
+
+	// patterns with a slash are relative to the base,
+	// others match at any level below it
+	prefix := "(?:.*/)?"
+	if strings.Contains(line, "/") {
+		prefix = ""
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	regex, err := regexp.Compile("^" + prefix + globToRegex(line) + "$")
+	if err != nil {
+		return pattern, false
+	}
+	pattern.regex = regex
+	return pattern, true
+}
+
+// globToRegex translates the gitignore glob syntax to a regular expression
+func globToRegex(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/") && (i == 0 || glob[i-1] == '/'):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case glob[i:] == "/**":
+			b.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.Replace(class, "/", "", -1) + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// match returns whether the list decides on the path, and if it is ignored.
+// The last matching pattern decides.
+func (list *ignoreList) match(path string, isDir bool) (matched, ignored bool) {
+	rel, err := filepath.Rel(list.base, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false, false
+	}
+	rel = filepath.ToSlash(rel)
+
+	for i := len(list.patterns) - 1; i >= 0; i-- {
+		pattern := list.patterns[i]
+		if pattern.dirOnly && !isDir {
+			continue
+		}
+		if pattern.regex.MatchString(rel) {
+			return true, !pattern.negate
+		}
+	}
+	return false, false
+}
+
+// isIgnored checks the ignore lists from the deepest directory up,
+// so that patterns closer to the path take precedence
+func isIgnored(lists []*ignoreList, path string, isDir bool) bool {
+	for i := len(lists) - 1; i >= 0; i-- {
+		if matched, ignored := lists[i].match(path, isDir); matched {
+			return ignored
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package finder
+
+import (
+	"io/ioutil"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/janosgyerik/dupfinder/utils"
+)
+
+func Test_ignoreList_match(t *testing.T) {
+	data := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"*.log", "a.log", false, true},
+		{"*.log", "x/y/a.log", false, true},
+		{"*.log", "a.txt", false, false},
+		{"/a.log", "a.log", false, true},
+		{"/a.log", "x/a.log", false, false},
+		{"x/*.log", "x/a.log", false, true},
+		{"x/*.log", "y/x/a.log", false, false},
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"**/tmp", "a/b/tmp", true, true},
+		{"**/tmp", "tmp", false, true},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"logs/**", "logs/x/y", false, true},
+		{"f?.txt", "f1.txt", false, true},
+		{"f?.txt", "f12.txt", false, false},
+		{"f[0-9].txt", "f7.txt", false, true},
+		{"f[!0-9].txt", "f7.txt", false, false},
+		{"\\#file", "#file", false, true},
+		{"# comment", "# comment", false, false},
+	}
+
+	for _, item := range data {
+		pattern, ok := parseIgnorePattern(item.pattern)
+		list := &ignoreList{base: "/base"}
+		if ok {
+			list.patterns = append(list.patterns, pattern)
+		}
+		_, ignored := list.match(path.Join("/base", item.path), item.isDir)
+		if ignored != item.ignored {
+			t.Errorf("pattern %q on %q: got ignored=%v; expected %v", item.pattern, item.path, ignored, item.ignored)
+		}
+	}
+}
+
+func Test_Find_ignore_files(t *testing.T) {
+	fdata := []fileData{
+		{relpath: "f1.txt"},
+		{relpath: "f2.log"},
+		{relpath: "keep.log"},
+		{relpath: "build/f3.txt"},
+		{relpath: "a/f4.log"},
+		{relpath: "a/f5.tmp"},
+		{relpath: "a/b/f6.tmp"},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	writeIgnoreFile := func(relpath, content string) {
+		utils.PanicIfFailed(ioutil.WriteFile(path.Join(tempdir, relpath), []byte(content), 0644))
+	}
+	writeIgnoreFile(IgnoreFileName, "*.log\n!keep.log\nbuild/\n"+IgnoreFileName+"\n")
+	// deeper files take precedence
+	writeIgnoreFile("a/"+IgnoreFileName, "!f4.log\n/*.tmp\n")
+
+	globalFile := path.Join(tempdir, "global-ignore")
+	writeIgnoreFile("global-ignore", "f1.txt\nglobal-ignore\n")
+
+	finder := NewFinder()
+	expected := []string{"a/b/f6.tmp", "a/f4.log", "f1.txt", "global-ignore", "keep.log"}
+	if actual := normalize(findPaths(finder)); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("got %#v; expected %#v", actual, expected)
+	}
+
+	utils.PanicIfFailed(finder.SetIgnoreFile(globalFile))
+	expected = []string{"a/b/f6.tmp", "a/f4.log", "keep.log"}
+	if actual := normalize(findPaths(finder)); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("with global ignore file: got %#v; expected %#v", actual, expected)
+	}
+}
@@ -0,0 +1,53 @@
+package dupfinder
+
+import (
+	"crypto/sha256"
+	"hash"
+
+	"github.com/janosgyerik/dupfinder/hashes"
+)
+
+// Hasher is a hash algorithm to compute the digests of file contents.
+// The Name identifies the digests computed with it in groups,
+// digest caches and snapshots.
+type Hasher interface {
+	Name() string
+	New() hash.Hash
+}
+
+type hasher struct {
+	name string
+	new  func() hash.Hash
+}
+
+func (h hasher) Name() string { return h.name }
+
+func (h hasher) New() hash.Hash { return h.new() }
+
+// Hashers are the built-in hash algorithms. SHA256 is the default.
+// BLAKE3 is a cryptographic alternative. XXH64 is a much faster,
+// non-cryptographic hash: files could be crafted to collide, use Verify
+// when they may come from untrusted sources.
+// Full digests are the same as those of sha256sum, b3sum and xxhsum.
+var Hashers = struct {
+	SHA256 Hasher
+	BLAKE3 Hasher
+	XXH64  Hasher
+}{
+	SHA256: hasher{"sha256", sha256.New},
+	BLAKE3: hasher{"blake3", hashes.NewBLAKE3},
+	XXH64:  hasher{"xxh64", func() hash.Hash { return hashes.NewXXH64() }},
+}
+
+// HasherNames are the names of the built-in hash algorithms
+var HasherNames = []string{Hashers.SHA256.Name(), Hashers.BLAKE3.Name(), Hashers.XXH64.Name()}
+
+// HasherByName returns the built-in hash algorithm with the given name
+func HasherByName(name string) (Hasher, bool) {
+	for _, h := range []Hasher{Hashers.SHA256, Hashers.BLAKE3, Hashers.XXH64} {
+		if h.Name() == name {
+			return h, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,53 @@
+package dupfinder
+
+import (
+	"encoding/hex"
+	"path"
+	"strings"
+	"testing"
+)
+
+func Test_Groups_digest_is_of_whole_content_with_chosen_hash(t *testing.T) {
+	small := "foo"
+	large := strings.Repeat("h", 3*partialSize) + "foo"
+	fdata := []fileData{
+		{"small1.txt", small},
+		{"small2.txt", small},
+		{"large1.txt", large},
+		{"large2.txt", large},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	for _, hasher := range []Hasher{Hashers.SHA256, Hashers.BLAKE3, Hashers.XXH64} {
+		tracker := NewTracker(Options.Hash(hasher))
+		for _, v := range fdata {
+			tracker.Add(path.Join(tempdir, v.relpath))
+		}
+
+		groups := tracker.Groups()
+		if len(groups) != 2 {
+			t.Fatalf("%s: got %d groups; expected 2", hasher.Name(), len(groups))
+		}
+		for i, content := range []string{small, large} {
+			h := hasher.New()
+			h.Write([]byte(content))
+			expected := hex.EncodeToString(h.Sum(nil))
+			if g := groups[i]; g.Digest != expected || g.Algorithm != hasher.Name() {
+				t.Errorf("%s: got %s digest %s; expected %s", hasher.Name(), g.Algorithm, g.Digest, expected)
+			}
+		}
+	}
+}
+
+func Test_HasherByName(t *testing.T) {
+	for _, name := range HasherNames {
+		if hasher, ok := HasherByName(name); !ok || hasher.Name() != name {
+			t.Errorf("got %v, %v for %s", hasher, ok, name)
+		}
+	}
+	if _, ok := HasherByName("md4"); ok {
+		t.Error("got hasher for unknown name")
+	}
+}
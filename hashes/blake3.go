@@ -0,0 +1,225 @@
+package hashes
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+const (
+	blake3BlockSize = 64
+	blake3ChunkSize = 1024
+
+	flagChunkStart = 1 << 0
+	flagChunkEnd   = 1 << 1
+	flagParent     = 1 << 2
+	flagRoot       = 1 << 3
+)
+
+var blake3IV = [8]uint32{
+	0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a,
+	0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19,
+}
+
+func g(a, b, c, d, mx, my uint32) (uint32, uint32, uint32, uint32) {
+	a += b + mx
+	d = bits.RotateLeft32(d^a, -16)
+	c += d
+	b = bits.RotateLeft32(b^c, -12)
+	a += b + my
+	d = bits.RotateLeft32(d^a, -8)
+	c += d
+	b = bits.RotateLeft32(b^c, -7)
+	return a, b, c, d
+}
+
+// message word indexes for each of the 7 rounds,
+// the result of permuting the words after each round
+var blake3Schedule = func() [7][16]int {
+	permutation := [16]int{2, 6, 3, 10, 7, 0, 4, 13, 1, 11, 12, 5, 9, 14, 15, 8}
+	var schedule [7][16]int
+	for i := range schedule[0] {
+		schedule[0][i] = i
+	}
+	for round := 1; round < len(schedule); round++ {
+		for i, j := range permutation {
+			schedule[round][i] = schedule[round-1][j]
+		}
+	}
+	return schedule
+}()
+
+func compress(cv *[8]uint32, m *[16]uint32, counter uint64, blockLen uint32, flags uint32) [16]uint32 {
+	s0, s1, s2, s3, s4, s5, s6, s7 := cv[0], cv[1], cv[2], cv[3], cv[4], cv[5], cv[6], cv[7]
+	s8, s9, s10, s11 := blake3IV[0], blake3IV[1], blake3IV[2], blake3IV[3]
+	s12, s13, s14, s15 := uint32(counter), uint32(counter>>32), blockLen, flags
+
+	for i := range blake3Schedule {
+		r := &blake3Schedule[i]
+		s0, s4, s8, s12 = g(s0, s4, s8, s12, m[r[0]], m[r[1]])
+		s1, s5, s9, s13 = g(s1, s5, s9, s13, m[r[2]], m[r[3]])
+		s2, s6, s10, s14 = g(s2, s6, s10, s14, m[r[4]], m[r[5]])
+		s3, s7, s11, s15 = g(s3, s7, s11, s15, m[r[6]], m[r[7]])
+		s0, s5, s10, s15 = g(s0, s5, s10, s15, m[r[8]], m[r[9]])
+		s1, s6, s11, s12 = g(s1, s6, s11, s12, m[r[10]], m[r[11]])
+		s2, s7, s8, s13 = g(s2, s7, s8, s13, m[r[12]], m[r[13]])
+		s3, s4, s9, s14 = g(s3, s4, s9, s14, m[r[14]], m[r[15]])
+	}
+
+	return [16]uint32{
+		s0 ^ s8, s1 ^ s9, s2 ^ s10, s3 ^ s11, s4 ^ s12, s5 ^ s13, s6 ^ s14, s7 ^ s15,
+		s8 ^ cv[0], s9 ^ cv[1], s10 ^ cv[2], s11 ^ cv[3], s12 ^ cv[4], s13 ^ cv[5], s14 ^ cv[6], s15 ^ cv[7],
+	}
+}
+
+func chainingValue(s [16]uint32) [8]uint32 {
+	var cv [8]uint32
+	copy(cv[:], s[:8])
+	return cv
+}
+
+func wordsOf(b []byte) [16]uint32 {
+	var block [blake3BlockSize]byte
+	copy(block[:], b)
+	var words [16]uint32
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint32(block[4*i:])
+	}
+	return words
+}
+
+// output is the input of the last compression of a node,
+// that gives its chaining value, or the hash when it is the root
+type output struct {
+	cv       [8]uint32
+	block    [16]uint32
+	counter  uint64
+	blockLen uint32
+	flags    uint32
+}
+
+func (o output) chainingValue() [8]uint32 {
+	return chainingValue(compress(&o.cv, &o.block, o.counter, o.blockLen, o.flags))
+}
+
+func parentOutput(left, right [8]uint32) output {
+	var block [16]uint32
+	copy(block[:8], left[:])
+	copy(block[8:], right[:])
+	return output{cv: blake3IV, block: block, blockLen: blake3BlockSize, flags: flagParent}
+}
+
+type chunkState struct {
+	cv               [8]uint32
+	counter          uint64
+	block            [blake3BlockSize]byte
+	blockLen         int
+	blocksCompressed int
+}
+
+func newChunkState(counter uint64) chunkState {
+	return chunkState{cv: blake3IV, counter: counter}
+}
+
+func (c *chunkState) len() int {
+	return blake3BlockSize*c.blocksCompressed + c.blockLen
+}
+
+func (c *chunkState) startFlag() uint32 {
+	if c.blocksCompressed == 0 {
+		return flagChunkStart
+	}
+	return 0
+}
+
+func (c *chunkState) update(p []byte) {
+	for len(p) > 0 {
+		if c.blockLen == blake3BlockSize {
+			words := wordsOf(c.block[:])
+			c.cv = chainingValue(compress(&c.cv, &words, c.counter, blake3BlockSize, c.startFlag()))
+			c.blocksCompressed++
+			c.blockLen = 0
+		}
+		n := copy(c.block[c.blockLen:], p)
+		c.blockLen += n
+		p = p[n:]
+	}
+}
+
+func (c *chunkState) output() output {
+	return output{
+		cv:       c.cv,
+		block:    wordsOf(c.block[:c.blockLen]),
+		counter:  c.counter,
+		blockLen: uint32(c.blockLen),
+		flags:    c.startFlag() | flagChunkEnd,
+	}
+}
+
+// blake3 computes the 32 byte BLAKE3 hash, as printed by b3sum
+type blake3 struct {
+	chunk chunkState
+	stack [][8]uint32
+}
+
+// NewBLAKE3 returns a new hash.Hash computing the 32 byte BLAKE3 hash,
+// the same as the output of b3sum. This is a portable implementation,
+// without the SIMD parallelism that makes BLAKE3 fast elsewhere.
+func NewBLAKE3() hash.Hash {
+	return &blake3{chunk: newChunkState(0)}
+}
+
+func (h *blake3) Reset() {
+	h.chunk = newChunkState(0)
+	h.stack = h.stack[:0]
+}
+
+func (h *blake3) Size() int { return 32 }
+
+func (h *blake3) BlockSize() int { return blake3BlockSize }
+
+// pushChunk merges the chaining value of a completed chunk into the tree,
+// merging subtrees as long as the number of chunks so far allows
+func (h *blake3) pushChunk(cv [8]uint32, chunks uint64) {
+	for chunks&1 == 0 {
+		last := len(h.stack) - 1
+		cv = parentOutput(h.stack[last], cv).chainingValue()
+		h.stack = h.stack[:last]
+		chunks >>= 1
+	}
+	h.stack = append(h.stack, cv)
+}
+
+func (h *blake3) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		// a full chunk is only finalized once more input arrives,
+		// since the last chunk must be finalized as the root
+		if h.chunk.len() == blake3ChunkSize {
+			chunks := h.chunk.counter + 1
+			h.pushChunk(h.chunk.output().chainingValue(), chunks)
+			h.chunk = newChunkState(chunks)
+		}
+		n := blake3ChunkSize - h.chunk.len()
+		if n > len(p) {
+			n = len(p)
+		}
+		h.chunk.update(p[:n])
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (h *blake3) Sum(b []byte) []byte {
+	out := h.chunk.output()
+	for i := len(h.stack) - 1; i >= 0; i-- {
+		out = parentOutput(h.stack[i], out.chainingValue())
+	}
+	s := compress(&out.cv, &out.block, 0, out.blockLen, out.flags|flagRoot)
+
+	var sum [32]byte
+	for i := 0; i < 8; i++ {
+		binary.LittleEndian.PutUint32(sum[4*i:], s[i])
+	}
+	return append(b, sum[:]...)
+}
@@ -0,0 +1,47 @@
+package hashes
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func Test_BLAKE3_matches_known_digests(t *testing.T) {
+	for _, test := range []struct {
+		input    []byte
+		expected string
+	}{
+		{nil, "af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262"},
+		{[]byte("abc"), "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85"},
+		{testInput(5000), "ee78d92070de3df1c57c37002abf0a6b1a6589acdeef4d8ffac7cf3d9e8f2836"},
+	} {
+		h := NewBLAKE3()
+		h.Write(test.input)
+		if actual := hex.EncodeToString(h.Sum(nil)); actual != test.expected {
+			t.Errorf("BLAKE3 of %d bytes: got %s; expected %s", len(test.input), actual, test.expected)
+		}
+	}
+}
+
+func Test_BLAKE3_same_digest_for_split_writes_and_after_Sum(t *testing.T) {
+	input := testInput(5000)
+	whole := NewBLAKE3()
+	whole.Write(input)
+	expected := whole.Sum(nil)
+
+	for _, size := range []int{1, 64, 1000, 1024} {
+		split := NewBLAKE3()
+		for p := input; len(p) > 0; {
+			n := size
+			if n > len(p) {
+				n = len(p)
+			}
+			split.Write(p[:n])
+			split.Sum(nil)
+			p = p[n:]
+		}
+		if actual := split.Sum(nil); !bytes.Equal(actual, expected) {
+			t.Errorf("writes of %d bytes: got %x; expected %x", size, actual, expected)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package hashes
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+const (
+	prime64_1 uint64 = 11400714785074694791
+	prime64_2 uint64 = 14029467366897019727
+	prime64_3 uint64 = 1609587929392839161
+	prime64_4 uint64 = 9650029242287828579
+	prime64_5 uint64 = 2870177450012600261
+)
+
+// xxh64 computes XXH64 with seed 0, as printed by xxhsum
+type xxh64 struct {
+	v     [4]uint64
+	total uint64
+	buf   [32]byte
+	n     int
+}
+
+// NewXXH64 returns a new hash.Hash64 computing the XXH64 checksum,
+// a fast non-cryptographic hash. The sum is in big-endian order,
+// the same as the output of xxhsum.
+func NewXXH64() hash.Hash64 {
+	h := &xxh64{}
+	h.Reset()
+	return h
+}
+
+func (h *xxh64) Reset() {
+	// variables, not constants, for the additions to wrap around
+	p1, p2 := prime64_1, prime64_2
+	h.v = [4]uint64{p1 + p2, p2, 0, -p1}
+	h.total = 0
+	h.n = 0
+}
+
+func (h *xxh64) Size() int { return 8 }
+
+func (h *xxh64) BlockSize() int { return 32 }
+
+func xxhRound(acc, input uint64) uint64 {
+	acc += input * prime64_2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * prime64_1
+}
+
+func xxhMergeRound(acc, val uint64) uint64 {
+	acc ^= xxhRound(0, val)
+	return acc*prime64_1 + prime64_4
+}
+
+func (h *xxh64) stripe(b []byte) {
+	h.v[0] = xxhRound(h.v[0], binary.LittleEndian.Uint64(b[0:8]))
+	h.v[1] = xxhRound(h.v[1], binary.LittleEndian.Uint64(b[8:16]))
+	h.v[2] = xxhRound(h.v[2], binary.LittleEndian.Uint64(b[16:24]))
+	h.v[3] = xxhRound(h.v[3], binary.LittleEndian.Uint64(b[24:32]))
+}
+
+func (h *xxh64) Write(p []byte) (int, error) {
+	written := len(p)
+	h.total += uint64(written)
+
+	if h.n > 0 {
+		copied := copy(h.buf[h.n:], p)
+		h.n += copied
+		p = p[copied:]
+		if h.n < len(h.buf) {
+			return written, nil
+		}
+		h.stripe(h.buf[:])
+		h.n = 0
+	}
+	for ; len(p) >= 32; p = p[32:] {
+		h.stripe(p)
+	}
+	h.n = copy(h.buf[:], p)
+	return written, nil
+}
+
+func (h *xxh64) Sum64() uint64 {
+	var acc uint64
+	if h.total >= 32 {
+		v := h.v
+		acc = bits.RotateLeft64(v[0], 1) + bits.RotateLeft64(v[1], 7) + bits.RotateLeft64(v[2], 12) + bits.RotateLeft64(v[3], 18)
+		for _, val := range v {
+			acc = xxhMergeRound(acc, val)
+		}
+	} else {
+		acc = prime64_5
+	}
+	acc += h.total
+
+	p := h.buf[:h.n]
+	for ; len(p) >= 8; p = p[8:] {
+		acc ^= xxhRound(0, binary.LittleEndian.Uint64(p))
+		acc = bits.RotateLeft64(acc, 27)*prime64_1 + prime64_4
+	}
+	if len(p) >= 4 {
+		acc ^= uint64(binary.LittleEndian.Uint32(p)) * prime64_1
+		acc = bits.RotateLeft64(acc, 23)*prime64_2 + prime64_3
+		p = p[4:]
+	}
+	for _, b := range p {
+		acc ^= uint64(b) * prime64_5
+		acc = bits.RotateLeft64(acc, 11) * prime64_1
+	}
+
+	acc ^= acc >> 33
+	acc *= prime64_2
+	acc ^= acc >> 29
+	acc *= prime64_3
+	acc ^= acc >> 32
+	return acc
+}
+
+func (h *xxh64) Sum(b []byte) []byte {
+	var sum [8]byte
+	binary.BigEndian.PutUint64(sum[:], h.Sum64())
+	return append(b, sum[:]...)
+}
@@ -0,0 +1,53 @@
+package hashes
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// bytes i % 251, as in the test vectors of BLAKE3
+func testInput(size int) []byte {
+	input := make([]byte, size)
+	for i := range input {
+		input[i] = byte(i % 251)
+	}
+	return input
+}
+
+func Test_XXH64_matches_known_digests(t *testing.T) {
+	for _, test := range []struct {
+		input    []byte
+		expected string
+	}{
+		{nil, "ef46db3751d8e999"},
+		{[]byte("abc"), "44bc2cf5ad770999"},
+		{testInput(5000), "a6833d648fd6a332"},
+	} {
+		h := NewXXH64()
+		h.Write(test.input)
+		if actual := hex.EncodeToString(h.Sum(nil)); actual != test.expected {
+			t.Errorf("XXH64 of %d bytes: got %s; expected %s", len(test.input), actual, test.expected)
+		}
+	}
+}
+
+func Test_XXH64_same_digest_for_split_writes(t *testing.T) {
+	input := testInput(1000)
+	whole := NewXXH64()
+	whole.Write(input)
+
+	for _, size := range []int{1, 7, 31, 33} {
+		split := NewXXH64()
+		for p := input; len(p) > 0; {
+			n := size
+			if n > len(p) {
+				n = len(p)
+			}
+			split.Write(p[:n])
+			p = p[n:]
+		}
+		if split.Sum64() != whole.Sum64() {
+			t.Errorf("writes of %d bytes: got %x; expected %x", size, split.Sum64(), whole.Sum64())
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package dupfinder
+
+import (
+	"github.com/janosgyerik/dupfinder/utils"
+)
+
+// parallel calls fn for each index in 0..n-1 using the configured number of
+// workers, and returns the errors in the order of the indexes.
+// Once the context is done, the remaining indexes fail with its error.
+func (t *tracker) parallel(n int, fn func(i int) error) []error {
+	var failed []error
+	for _, err := range utils.Parallel(t.ctx, n, t.jobs, fn) {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	return failed
+}
+
+func (t *tracker) bytesRead(count int) {
+	t.emit(func(listener EventListener) { listener.BytesRead(count) })
+}
@@ -0,0 +1,108 @@
+package dupfinder
+
+import (
+	"sync"
+	"time"
+)
+
+// ProgressStats is a snapshot of the current phase of adding files.
+// TotalBytes is the number of bytes to read in the phase, as planned;
+// ETA is negative when it cannot be estimated.
+type ProgressStats struct {
+	Phase          Phase
+	Files          int
+	TotalFiles     int
+	Bytes          int64
+	TotalBytes     int64
+	BytesRead      int64
+	Current        string
+	Elapsed        time.Duration
+	BytesPerSecond float64
+	FilesPerSecond float64
+	ETA            time.Duration
+}
+
+// Progress is an EventListener that keeps track of the progress of AddAll,
+// to report throughput and the estimated time left in the current phase.
+// Stats may be called concurrently with the events.
+type Progress struct {
+	NullEventListener
+	mutex      sync.Mutex
+	now        func() time.Time
+	phase      Phase
+	phaseStart time.Time
+	files      int
+	totalFiles int
+	bytes      int64
+	totalBytes int64
+	bytesRead  int64
+	current    string
+}
+
+func NewProgress() *Progress {
+	p := &Progress{now: time.Now}
+	p.phaseStart = p.now()
+	return p
+}
+
+func (p *Progress) PhaseChanged(phase Phase, files int, bytes int64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.phase = phase
+	p.phaseStart = p.now()
+	p.files = 0
+	p.totalFiles = files
+	p.bytes = 0
+	p.totalBytes = bytes
+	p.current = ""
+}
+
+func (p *Progress) FileStarted(path string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.files++
+	p.current = path
+}
+
+func (p *Progress) BytesRead(count int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.bytes += int64(count)
+	p.bytesRead += int64(count)
+}
+
+func (p *Progress) Stats() ProgressStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	stats := ProgressStats{
+		Phase:      p.phase,
+		Files:      p.files,
+		TotalFiles: p.totalFiles,
+		Bytes:      p.bytes,
+		TotalBytes: p.totalBytes,
+		BytesRead:  p.bytesRead,
+		Current:    p.current,
+		Elapsed:    p.now().Sub(p.phaseStart),
+		ETA:        -1,
+	}
+
+	seconds := stats.Elapsed.Seconds()
+	if seconds <= 0 {
+		return stats
+	}
+	stats.BytesPerSecond = float64(stats.Bytes) / seconds
+	stats.FilesPerSecond = float64(stats.Files) / seconds
+
+	if stats.TotalBytes > 0 && stats.BytesPerSecond > 0 {
+		remaining := stats.TotalBytes - stats.Bytes
+		if remaining < 0 {
+			remaining = 0
+		}
+		stats.ETA = time.Duration(float64(remaining) / stats.BytesPerSecond * float64(time.Second))
+	}
+	return stats
+}
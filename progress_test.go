@@ -0,0 +1,88 @@
+package dupfinder
+
+import (
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Progress_Stats(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	p := NewProgress()
+	p.now = func() time.Time { return now }
+
+	p.PhaseChanged(PhaseFullDigest, 4, 1000)
+	p.FileStarted("f1")
+	p.BytesRead(200)
+	p.FileStarted("f2")
+	p.BytesRead(50)
+	now = start.Add(5 * time.Second)
+
+	stats := p.Stats()
+	if stats.Phase != PhaseFullDigest || stats.Files != 2 || stats.TotalFiles != 4 || stats.Current != "f2" {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if stats.BytesPerSecond != 50 || stats.FilesPerSecond != 0.4 {
+		t.Errorf("got %f bytes/s and %f files/s; expected 50 and 0.4", stats.BytesPerSecond, stats.FilesPerSecond)
+	}
+	if expected := 15 * time.Second; stats.ETA != expected {
+		t.Errorf("got ETA %v; expected %v", stats.ETA, expected)
+	}
+
+	p.PhaseChanged(PhaseGrouping, 4, 0)
+	if stats := p.Stats(); stats.ETA >= 0 || stats.Bytes != 0 || stats.BytesRead != 250 {
+		t.Errorf("unexpected stats after phase change %+v", stats)
+	}
+}
+
+func Test_Progress_planned_bytes_match_bytes_read(t *testing.T) {
+	head := strings.Repeat("h", partialSize)
+	tail := strings.Repeat("t", partialSize)
+	fdata := []fileData{
+		{"f1.txt", head + "foo" + tail},
+		{"f2.txt", head + "foo" + tail},
+		{"f3.txt", head + "bar" + tail},
+		{"f4.txt", "foo"},
+		{"f5.txt", "bar"},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	listener := &phaseBytesListener{Progress: NewProgress()}
+	tracker := NewTracker()
+	tracker.SetEventListener(listener)
+
+	paths := make(chan string, len(fdata))
+	for _, v := range fdata {
+		paths <- path.Join(tempdir, v.relpath)
+	}
+	close(paths)
+	tracker.AddAll(paths)
+
+	for phase, bytes := range listener.read {
+		if planned := listener.planned[phase]; bytes != planned {
+			t.Errorf("%v: got %d bytes read; planned %d", phase, bytes, planned)
+		}
+	}
+}
+
+// phaseBytesListener compares the planned bytes of each phase with the bytes read
+type phaseBytesListener struct {
+	*Progress
+	planned map[Phase]int64
+	read    map[Phase]int64
+}
+
+func (l *phaseBytesListener) PhaseChanged(phase Phase, files int, bytes int64) {
+	if l.planned == nil {
+		l.planned = make(map[Phase]int64)
+		l.read = make(map[Phase]int64)
+	}
+	stats := l.Progress.Stats()
+	l.read[stats.Phase] = stats.Bytes
+	l.planned[phase] = bytes
+	l.Progress.PhaseChanged(phase, files, bytes)
+}
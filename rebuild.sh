@@ -26,7 +26,7 @@ else
 fi
 
 arch=amd64
-cli=cmd/$basename/main.go
+cli=./cmd/$basename
 
 mkdir -p build
 
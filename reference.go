@@ -0,0 +1,75 @@
+package dupfinder
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/janosgyerik/dupfinder/utils"
+)
+
+// dirSet is a set of directories, such as the directories of reference files
+// or the roots of the scan, with relative paths resolved against the working directory
+type dirSet struct {
+	dirs    []string
+	workdir string
+}
+
+func newDirSet(dirs []string) *dirSet {
+	workdir, _ := os.Getwd()
+	r := &dirSet{workdir: workdir}
+	for _, dir := range dirs {
+		r.dirs = append(r.dirs, r.abs(dir))
+	}
+	return r
+}
+
+func (r *dirSet) abs(path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(r.workdir, path)
+}
+
+// contains reports whether the path is one of the directories or under one of them
+func (r *dirSet) contains(path string) bool {
+	if r == nil {
+		return false
+	}
+	path = r.abs(path)
+	for _, dir := range r.dirs {
+		if utils.IsUnder(dir, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// reportable reports whether the group is a group of duplicates
+// to report: at least two files, not all of them reference files
+func (g *group) reportable() bool {
+	if len(g.items) < 2 {
+		return false
+	}
+	for _, item := range g.items {
+		if !item.reference {
+			return true
+		}
+	}
+	return false
+}
+
+// hasReference reports whether any file of the group is a reference file
+func (g *group) hasReference() bool {
+	for _, item := range g.items {
+		if item.reference {
+			return true
+		}
+	}
+	return false
+}
+
+// IsReference reports whether the i-th path of the group
+// is under one of the directories set by Options.Reference
+func (g Group) IsReference(i int) bool {
+	return i < len(g.References) && g.References[i]
+}
@@ -0,0 +1,85 @@
+package dupfinder
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_Reference_groups_of_reference_files_only_are_not_reported(t *testing.T) {
+	fdata := []fileData{
+		{"archive/a1", "apple"},
+		{"archive/a2", "apple"},
+		{"archive/c1", "cherry"},
+		{"archive/c2", "cherry"},
+		{"archive2/c3", "cherry"},
+		{"incoming/a", "apple"},
+		{"incoming/b1", "banana"},
+		{"incoming/b2", "banana"},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	tracker := NewTracker(Options.Reference(path.Join(tempdir, "archive")))
+	listener := &recordingListener{}
+	tracker.SetEventListener(listener)
+	for _, v := range fdata {
+		tracker.Add(path.Join(tempdir, v.relpath))
+	}
+
+	expected := [][]string{{"archive/a1", "archive/a2", "incoming/a"}, {"archive/c1", "archive/c2", "archive2/c3"}, {"incoming/b1", "incoming/b2"}}
+	if actual := normalize(tracker.Dups()); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("got:\n%#v\nexpected:\n%#v", actual, expected)
+	}
+
+	expectedEvents := []string{"created 2 c3 6 3", "created 1 a 5 3", "created 3 b2 6 2"}
+	if !reflect.DeepEqual(expectedEvents, listener.events) {
+		t.Errorf("got events:\n%#v\nexpected:\n%#v", listener.events, expectedEvents)
+	}
+
+	groups := tracker.Groups()
+	if expected := []bool{true, true, false}; !reflect.DeepEqual(expected, groups[0].References) {
+		t.Errorf("got references %v; expected %v", groups[0].References, expected)
+	}
+	if groups[0].IsReference(2) || !groups[0].IsReference(0) {
+		t.Error("wrong IsReference")
+	}
+
+	report := tracker.Report()
+	if expected := int64(5 + 6 + 6); report.Wasted != expected {
+		t.Errorf("got wasted %d; expected %d", report.Wasted, expected)
+	}
+}
+
+func Test_dirSet_contains(t *testing.T) {
+	workdir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs := newDirSet([]string{"archive", filepath.Join(workdir, "other") + "/"})
+
+	for _, test := range []struct {
+		path     string
+		expected bool
+	}{
+		{"archive/a", true},
+		{"archive", true},
+		{filepath.Join(workdir, "archive", "sub", "a"), true},
+		{"other/a", true},
+		{"archive2/a", false},
+		{"a", false},
+		{"../archive/a", false},
+	} {
+		if actual := refs.contains(test.path); actual != test.expected {
+			t.Errorf("contains(%q): got %v; expected %v", test.path, actual, test.expected)
+		}
+	}
+
+	var none *dirSet
+	if none.contains("archive/a") {
+		t.Error("nil reference dirs contain a path")
+	}
+}
@@ -0,0 +1,99 @@
+package dupfinder
+
+import (
+	"sort"
+
+	"github.com/janosgyerik/dupfinder/utils"
+)
+
+// GroupReport is the space taken by the extra copies of a group of duplicates.
+// Wasted is the apparent size of the extra copies, Size × (Copies − 1).
+// Reclaimable is the disk space freed by keeping only one copy: sparse files
+// free only the blocks they allocate, and files with hard links outside
+// the scanned paths free nothing. In groups with reference files,
+// the extra copies are all the files that are not reference files.
+type GroupReport struct {
+	Group
+	Copies      int
+	Wasted      int64
+	Reclaimable int64
+}
+
+// Report summarizes the space taken by duplicates, and the space already
+// saved by hard links. Groups are sorted by reclaimable space, largest first.
+type Report struct {
+	Groups      []GroupReport
+	Files       int
+	Wasted      int64
+	Reclaimable int64
+	Linked      int
+	LinkedBytes int64
+}
+
+// freed returns the disk space freed by deleting the file and its known links
+func (item *fileItem) freed() int64 {
+	if count, ok := utils.LinkCount(item.info); ok && count > uint64(1+len(item.links)) {
+		return 0
+	}
+	if allocated, ok := utils.AllocatedSize(item.info); ok && allocated < item.size {
+		return allocated
+	}
+	return item.size
+}
+
+func (g *group) report() GroupReport {
+	r := GroupReport{Group: g.export(), Copies: len(g.items)}
+
+	if g.hasReference() {
+		for _, item := range g.items {
+			if !item.reference {
+				r.Wasted += r.Size
+				r.Reclaimable += item.freed()
+			}
+		}
+		return r
+	}
+
+	r.Wasted = r.Size * int64(r.Copies-1)
+
+	// keeping the copy that would free the least space reclaims the most
+	var total, least int64
+	for i, item := range g.items {
+		freed := item.freed()
+		total += freed
+		if i == 0 || freed < least {
+			least = freed
+		}
+	}
+	r.Reclaimable = total - least
+	return r
+}
+
+func (t *tracker) Report() Report {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var report Report
+	for _, g := range t.groups {
+		for _, item := range g.items {
+			report.Linked += len(item.links)
+			report.LinkedBytes += item.size * int64(len(item.links))
+		}
+		if !g.reportable() {
+			continue
+		}
+		r := g.report()
+		report.Groups = append(report.Groups, r)
+		report.Files += r.Copies
+		report.Wasted += r.Wasted
+		report.Reclaimable += r.Reclaimable
+	}
+
+	sort.Slice(report.Groups, func(i, j int) bool {
+		if report.Groups[i].Reclaimable != report.Groups[j].Reclaimable {
+			return report.Groups[i].Reclaimable > report.Groups[j].Reclaimable
+		}
+		return report.Groups[i].Paths[0] < report.Groups[j].Paths[0]
+	})
+	return report
+}
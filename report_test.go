@@ -0,0 +1,62 @@
+package dupfinder
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/janosgyerik/dupfinder/utils"
+)
+
+func Test_Report(t *testing.T) {
+	big := strings.Repeat("b", 8192)
+	fdata := []fileData{
+		{"small1", "foo"},
+		{"small2", "foo"},
+		{"small3", "foo"},
+		{"big1", big},
+		{"big2", big},
+		{"linked-outside", big},
+		{"unique", "bar"},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	// a hard link outside the scanned paths keeps the content on disk
+	utils.PanicIfFailed(os.Link(path.Join(tempdir, "linked-outside"), path.Join(tempdir, "outside")))
+	// a hard link among the scanned paths takes no extra space
+	utils.PanicIfFailed(os.Link(path.Join(tempdir, "small1"), path.Join(tempdir, "small1-link")))
+	fdata = append(fdata, fileData{"small1-link", ""})
+
+	tracker := NewTracker()
+	for _, v := range fdata {
+		utils.PanicIfFailed(tracker.Add(path.Join(tempdir, v.relpath)))
+	}
+	report := tracker.Report()
+
+	var actual [][]int64
+	for _, g := range report.Groups {
+		actual = append(actual, []int64{int64(g.Copies), g.Wasted})
+	}
+	expected := [][]int64{{3, 2 * 8192}, {3, 2 * 3}}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("got copies and wasted bytes %v; expected %v", actual, expected)
+	}
+
+	if report.Files != 6 || report.Wasted != 2*8192+2*3 {
+		t.Errorf("got %d files and %d bytes wasted", report.Files, report.Wasted)
+	}
+	if report.Linked != 1 || report.LinkedBytes != 3 {
+		t.Errorf("got %d linked paths with %d bytes; expected 1 with 3", report.Linked, report.LinkedBytes)
+	}
+
+	// deleting big1 or big2 frees their blocks, linked-outside frees nothing
+	if _, ok := utils.LinkCount(report.Groups[0].Infos[0]); ok {
+		if allocated, _ := utils.AllocatedSize(report.Groups[0].Infos[0]); report.Groups[0].Reclaimable != 2*allocated {
+			t.Errorf("got %d bytes reclaimable; expected %d", report.Groups[0].Reclaimable, 2*allocated)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package dupfinder
+
+import (
+	"io"
+	"os"
+	"sort"
+)
+
+// Sampling selects the parts of files to compare in lazy mode:
+// a percentage at the start and at the end,
+// and a number of evenly spaced blocks in between
+type Sampling struct {
+	HeadPercent int
+	TailPercent int
+	Blocks      int
+}
+
+type byteRange struct {
+	start int64
+	end   int64
+}
+
+// ranges returns the sorted, non-overlapping byte ranges to sample
+// in a file of the given size
+func (s Sampling) ranges(size int64) []byteRange {
+	ranges := []byteRange{
+		{0, size * int64(s.HeadPercent) / 100},
+		{size - size*int64(s.TailPercent)/100, size},
+	}
+	for i := 1; i <= s.Blocks; i++ {
+		middle := size * int64(i) / int64(s.Blocks+1)
+		ranges = append(ranges, byteRange{middle - chunkSize/2, middle + chunkSize/2})
+	}
+
+	for i := range ranges {
+		if ranges[i].start < 0 {
+			ranges[i].start = 0
+		}
+		if ranges[i].end > size {
+			ranges[i].end = size
+		}
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start < ranges[j].start })
+
+	var merged []byteRange
+	for _, r := range ranges {
+		if r.start >= r.end {
+			continue
+		}
+		if last := len(merged) - 1; last >= 0 && r.start <= merged[last].end {
+			if r.end > merged[last].end {
+				merged[last].end = r.end
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+func (s Sampling) coversAll(size int64) bool {
+	ranges := s.ranges(size)
+	return size == 0 || len(ranges) == 1 && ranges[0].start == 0 && ranges[0].end == size
+}
+
+// isSampled reports whether files of the given size are compared
+// by sampled digests, which make probable duplicates only
+func (t *tracker) isSampled(size int64) bool {
+	return t.sampling != nil && !partialCoversAll(size) && !t.sampling.coversAll(size)
+}
+
+// contentDigest returns the digest that decides whether two files
+// of the same size and partial digest are duplicates
+func (t *tracker) contentDigest(item *fileItem) (string, error) {
+	if t.isSampled(item.size) {
+		return t.sampledDigest(item)
+	}
+	return t.fullDigest(item)
+}
+
+func (t *tracker) sampledDigest(item *fileItem) (string, error) {
+	if item.sampled != "" {
+		return item.sampled, nil
+	}
+
+	f, err := os.Open(item.path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	t.fileStarted(item.path)
+
+	h := t.hasher.New()
+	for _, r := range t.sampling.ranges(item.size) {
+		if _, err := f.Seek(r.start, io.SeekStart); err != nil {
+			return "", err
+		}
+		if err := t.copyN(h, f, r.end-r.start); err != nil {
+			return "", err
+		}
+	}
+
+	item.sampled = string(h.Sum(nil))
+	return item.sampled, nil
+}
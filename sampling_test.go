@@ -0,0 +1,87 @@
+package dupfinder
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_Sampling_ranges(t *testing.T) {
+	data := []struct {
+		sampling Sampling
+		size     int64
+		expected []byteRange
+	}{
+		{Sampling{10, 10, 0}, 1000, []byteRange{{0, 100}, {900, 1000}}},
+		{Sampling{50, 50, 0}, 1000, []byteRange{{0, 1000}}},
+		{Sampling{0, 0, 1}, 100000, []byteRange{{50000 - chunkSize/2, 50000 + chunkSize/2}}},
+		{Sampling{10, 10, 1}, 1000, []byteRange{{0, 1000}}},
+		{Sampling{1, 1, 3}, 1000000, []byteRange{
+			{0, 10000},
+			{250000 - chunkSize/2, 250000 + chunkSize/2},
+			{500000 - chunkSize/2, 500000 + chunkSize/2},
+			{750000 - chunkSize/2, 750000 + chunkSize/2},
+			{990000, 1000000},
+		}},
+	}
+
+	for _, item := range data {
+		if actual := item.sampling.ranges(item.size); !reflect.DeepEqual(item.expected, actual) {
+			t.Errorf("%v of %d: got %v; expected %v", item.sampling, item.size, actual, item.expected)
+		}
+	}
+}
+
+func Test_lazy_groups_are_probable_unless_verified(t *testing.T) {
+	size := 100 * partialSize
+	middle := size / 2
+	content := strings.Repeat("x", size)
+	differentMiddle := content[:middle] + "y" + content[middle+1:]
+	differentQuarter := content[:size/4] + "y" + content[size/4+1:]
+	fdata := []fileData{
+		{"f1.txt", content},
+		{"f2.txt", differentQuarter},
+		{"f3.txt", differentMiddle},
+		{"f4.txt", content},
+		{"small1.txt", "foo"},
+		{"small2.txt", "foo"},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	sampling := Sampling{HeadPercent: 10, TailPercent: 10, Blocks: 1}
+	digest := func(s string) string { return fmt.Sprintf("%x", sha256.Sum256([]byte(s))) }
+
+	data := []struct {
+		options  []Option
+		expected []Group
+	}{
+		{[]Option{Options.Lazy(sampling)}, []Group{
+			{Paths: []string{"small1.txt", "small2.txt"}, Size: 3, Digest: digest("foo"), Algorithm: "sha256"},
+			{Paths: []string{"f1.txt", "f2.txt", "f4.txt"}, Size: int64(size), Probable: true},
+		}},
+		{[]Option{Options.Lazy(sampling), Options.Verify}, []Group{
+			{Paths: []string{"small1.txt", "small2.txt"}, Size: 3, Digest: digest("foo"), Algorithm: "sha256"},
+			{Paths: []string{"f1.txt", "f4.txt"}, Size: int64(size), Digest: digest(content), Algorithm: "sha256"},
+		}},
+	}
+
+	for _, item := range data {
+		tracker := NewTracker(item.options...)
+		for _, v := range fdata {
+			tracker.Add(path.Join(tempdir, v.relpath))
+		}
+
+		var actual []Group
+		for _, g := range tracker.Groups() {
+			actual = append(actual, Group{Paths: normalize([][]string{g.Paths})[0], Size: g.Size, Probable: g.Probable, Digest: g.Digest, Algorithm: g.Algorithm})
+		}
+		if !reflect.DeepEqual(item.expected, actual) {
+			t.Errorf("got:\n%#v\nexpected:\n%#v", actual, item.expected)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package similar
+
+import (
+	"context"
+)
+
+// disjointSets tracks a partition of the indexes 0..n-1 (union-find)
+type disjointSets struct {
+	parent []int
+}
+
+func newDisjointSets(n int) *disjointSets {
+	parent := make([]int, n)
+	for i := range parent {
+		parent[i] = i
+	}
+	return &disjointSets{parent}
+}
+
+func (s *disjointSets) find(i int) int {
+	for s.parent[i] != i {
+		s.parent[i] = s.parent[s.parent[i]]
+		i = s.parent[i]
+	}
+	return i
+}
+
+func (s *disjointSets) union(i, j int) {
+	ri, rj := s.find(i), s.find(j)
+	if ri < rj {
+		s.parent[rj] = ri
+	} else if rj < ri {
+		s.parent[ri] = rj
+	}
+}
+
+// groups returns the indexes of each set in increasing order,
+// the sets ordered by their smallest index
+func (s *disjointSets) groups() [][]int {
+	var groups [][]int
+	index := make(map[int]int)
+	for i := range s.parent {
+		root := s.find(i)
+		g, ok := index[root]
+		if !ok {
+			g = len(groups)
+			index[root] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	return groups
+}
+
+// failures returns the errors that are not nil, with the error
+// of the context only once
+func failures(ctx context.Context, errs []error) []error {
+	var failed []error
+	for _, err := range errs {
+		if err != nil && err != ctx.Err() {
+			failed = append(failed, err)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		failed = append(failed, err)
+	}
+	return failed
+}
@@ -0,0 +1,30 @@
+package similar
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/janosgyerik/dupfinder/utils"
+)
+
+func Test_disjointSets_groups(t *testing.T) {
+	sets := newDisjointSets(6)
+	sets.union(4, 1)
+	sets.union(5, 3)
+	sets.union(3, 1)
+
+	expected := [][]int{{0}, {1, 3, 4, 5}, {2}}
+	if actual := sets.groups(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("got %v, expected %v", actual, expected)
+	}
+}
+
+func Test_failures_reports_context_error_once(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	errs := utils.Parallel(ctx, 3, 2, func(i int) error { return nil })
+	if failed := failures(ctx, errs); len(failed) != 1 || failed[0] != context.Canceled {
+		t.Errorf("got %v", failed)
+	}
+}
@@ -0,0 +1,394 @@
+// Package similar finds files with similar, rather than identical, content.
+package similar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/janosgyerik/dupfinder/utils"
+)
+
+// ImageHash is a 64-bit perceptual hash of an image.
+// Similar images have hashes with a small Hamming distance.
+type ImageHash uint64
+
+// Distance returns the number of bits that differ between the hashes
+func (h ImageHash) Distance(other ImageHash) int {
+	return bits.OnesCount64(uint64(h ^ other))
+}
+
+func (h ImageHash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// ImageHasher is a perceptual hash algorithm
+type ImageHasher interface {
+	Name() string
+	Hash(img image.Image) ImageHash
+}
+
+type imageHasher struct {
+	name string
+	hash func(img image.Image) ImageHash
+}
+
+func (h imageHasher) Name() string { return h.name }
+
+func (h imageHasher) Hash(img image.Image) ImageHash { return h.hash(img) }
+
+// ImageHashers are the built-in perceptual hash algorithms.
+// Average compares each pixel of an 8x8 thumbnail with the mean,
+// it is the fastest but finds more false matches.
+// Difference compares adjacent pixels of a 9x8 thumbnail.
+// Perception compares the low frequencies of a 32x32 thumbnail
+// with their median, it is the most robust to re-encoding and edits.
+var ImageHashers = struct {
+	Average    ImageHasher
+	Difference ImageHasher
+	Perception ImageHasher
+}{
+	Average:    imageHasher{"ahash", averageHash},
+	Difference: imageHasher{"dhash", differenceHash},
+	Perception: imageHasher{"phash", perceptionHash},
+}
+
+// ImageHasherNames are the names of the built-in perceptual hash algorithms
+var ImageHasherNames = []string{ImageHashers.Average.Name(), ImageHashers.Difference.Name(), ImageHashers.Perception.Name()}
+
+// ImageHasherByName returns the built-in perceptual hash algorithm with the given name
+func ImageHasherByName(name string) (ImageHasher, bool) {
+	for _, h := range []ImageHasher{ImageHashers.Average, ImageHashers.Difference, ImageHashers.Perception} {
+		if h.Name() == name {
+			return h, true
+		}
+	}
+	return nil, false
+}
+
+var imageExtensions = []string{".jpg", ".jpeg", ".png", ".gif"}
+
+// IsImage returns true if the path has the extension of a supported image format:
+// JPEG, PNG or GIF
+func IsImage(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range imageExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxImagePixels is the largest number of pixels of images to decode.
+// Decoded images take up to 8 bytes per pixel in memory.
+const MaxImagePixels = 50 * 1000 * 1000
+
+// ErrImageTooLarge is returned by HashImageFile for images
+// of more than MaxImagePixels pixels, which are not decoded
+var ErrImageTooLarge = errors.New("image too large")
+
+// HashImageFile decodes the image file and returns its perceptual hash.
+// Errors are *os.PathError values naming the file.
+func HashImageFile(path string, hasher ImageHasher) (ImageHash, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	// check the dimensions before decoding, which allocates all pixels
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, &os.PathError{Op: "decode", Path: path, Err: err}
+	}
+	if int64(config.Width)*int64(config.Height) > MaxImagePixels {
+		return 0, &os.PathError{Op: "decode", Path: path, Err: fmt.Errorf("%w: %dx%d pixels", ErrImageTooLarge, config.Width, config.Height)}
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return 0, &os.PathError{Op: "decode", Path: path, Err: err}
+	}
+	return hasher.Hash(img), nil
+}
+
+// ImageGroup is a group of similar images.
+// Paths of identical content are listed together, with the same hash.
+// Distances are the Hamming distances of the hashes from the first one.
+type ImageGroup struct {
+	Paths     []string
+	Hashes    []ImageHash
+	Distances []int
+}
+
+// MaxDistance returns the largest distance of an image from the first one
+func (g ImageGroup) MaxDistance() int {
+	max := 0
+	for _, d := range g.Distances {
+		if d > max {
+			max = d
+		}
+	}
+	return max
+}
+
+// GroupImages groups the images whose hashes are within maxDistance of each other.
+// Each item of contents lists the paths of identical files, as returned by
+// Tracker.Contents, only the first of them is decoded. Images are grouped
+// transitively: an image may be farther than maxDistance from some images
+// of its group, if they are similar to others in between.
+// Only groups of more than one distinct content are returned.
+// Images are decoded by the given number of workers, until the context is done.
+func GroupImages(ctx context.Context, contents [][]string, hasher ImageHasher, maxDistance, jobs int) ([]ImageGroup, []error) {
+	hashes := make([]ImageHash, len(contents))
+	errs := utils.Parallel(ctx, len(contents), jobs, func(i int) error {
+		hash, err := HashImageFile(contents[i][0], hasher)
+		hashes[i] = hash
+		return err
+	})
+	failed := make(map[int]bool)
+	for i, err := range errs {
+		if err != nil {
+			failed[i] = true
+		}
+	}
+
+	sets := newDisjointSets(len(contents))
+	tree := &bkTree{}
+	for i, hash := range hashes {
+		if failed[i] {
+			continue
+		}
+		for _, j := range tree.search(hash, maxDistance) {
+			sets.union(i, j)
+		}
+		tree.add(hash, i)
+	}
+
+	var groups []ImageGroup
+	for _, members := range sets.groups() {
+		if len(members) < 2 {
+			continue
+		}
+		first := hashes[members[0]]
+		var group ImageGroup
+		for _, i := range members {
+			for _, path := range contents[i] {
+				group.Paths = append(group.Paths, path)
+				group.Hashes = append(group.Hashes, hashes[i])
+				group.Distances = append(group.Distances, first.Distance(hashes[i]))
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups, failures(ctx, errs)
+}
+
+// grayscale returns the luminance of the image scaled to w x h pixels,
+// in row-major order. Each pixel is the average of the area it covers.
+func grayscale(img image.Image, w, h int) []float64 {
+	bounds := img.Bounds()
+	luminance := luminanceFunc(img)
+
+	pixels := make([]float64, w*h)
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return pixels
+	}
+	for ty := 0; ty < h; ty++ {
+		y0, y1 := span(ty, h, height)
+		for tx := 0; tx < w; tx++ {
+			x0, x1 := span(tx, w, width)
+			sum := 0
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					sum += int(luminance(bounds.Min.X+x, bounds.Min.Y+y))
+				}
+			}
+			pixels[ty*w+tx] = float64(sum) / float64((x1-x0)*(y1-y0))
+		}
+	}
+	return pixels
+}
+
+// span returns the range of source pixels covered by target pixel i of n,
+// at least one pixel
+func span(i, n, size int) (int, int) {
+	start := i * size / n
+	end := (i + 1) * size / n
+	if end <= start {
+		end = start + 1
+	}
+	return start, end
+}
+
+// luminanceFunc returns a function computing the luminance of a pixel,
+// reading the luma plane directly for JPEG and grayscale images
+func luminanceFunc(img image.Image) func(x, y int) uint8 {
+	switch img := img.(type) {
+	case *image.YCbCr:
+		return func(x, y int) uint8 { return img.Y[img.YOffset(x, y)] }
+	case *image.Gray:
+		return func(x, y int) uint8 { return img.Pix[img.PixOffset(x, y)] }
+	default:
+		return func(x, y int) uint8 {
+			r, g, b, _ := img.At(x, y).RGBA()
+			// same weights as color.GrayModel
+			return uint8((19595*r + 38470*g + 7471*b + 1<<15) >> 24)
+		}
+	}
+}
+
+func averageHash(img image.Image) ImageHash {
+	pixels := grayscale(img, 8, 8)
+	mean := 0.0
+	for _, p := range pixels {
+		mean += p
+	}
+	mean /= float64(len(pixels))
+	return bitsAbove(pixels, mean)
+}
+
+func differenceHash(img image.Image) ImageHash {
+	pixels := grayscale(img, 9, 8)
+	var hash ImageHash
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if pixels[y*9+x+1] > pixels[y*9+x] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+func perceptionHash(img image.Image) ImageHash {
+	const size, low = 32, 8
+	pixels := grayscale(img, size, size)
+
+	// the low frequencies of the 2D DCT-II, rows first
+	rows := make([]float64, size*low)
+	for y := 0; y < size; y++ {
+		for k := 0; k < low; k++ {
+			sum := 0.0
+			for x := 0; x < size; x++ {
+				sum += pixels[y*size+x] * dctCosines[k][x]
+			}
+			rows[y*low+k] = sum
+		}
+	}
+	freqs := make([]float64, low*low)
+	for k := 0; k < low; k++ {
+		for j := 0; j < low; j++ {
+			sum := 0.0
+			for y := 0; y < size; y++ {
+				sum += rows[y*low+j] * dctCosines[k][y]
+			}
+			freqs[k*low+j] = sum
+		}
+	}
+
+	sorted := append([]float64(nil), freqs...)
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+	return bitsAbove(freqs, median)
+}
+
+var dctCosines = func() [8][32]float64 {
+	var cosines [8][32]float64
+	for k := range cosines {
+		for n := range cosines[k] {
+			cosines[k][n] = math.Cos(math.Pi * float64(2*n+1) * float64(k) / 64)
+		}
+	}
+	return cosines
+}()
+
+// bitsAbove returns a hash with a bit set for each value above the threshold,
+// the first value in the most significant bit
+func bitsAbove(values []float64, threshold float64) ImageHash {
+	var hash ImageHash
+	for _, v := range values {
+		hash <<= 1
+		if v > threshold {
+			hash |= 1
+		}
+	}
+	return hash
+}
+
+// bkTree is a BK-tree of hashes, to find the hashes within a distance
+// without comparing with all of them
+type bkTree struct {
+	root *bkNode
+}
+
+type bkNode struct {
+	hash     ImageHash
+	ids      []int
+	children map[int]*bkNode
+}
+
+func (t *bkTree) add(hash ImageHash, id int) {
+	if t.root == nil {
+		t.root = &bkNode{hash: hash, ids: []int{id}}
+		return
+	}
+	node := t.root
+	for {
+		d := node.hash.Distance(hash)
+		if d == 0 {
+			node.ids = append(node.ids, id)
+			return
+		}
+		child, ok := node.children[d]
+		if !ok {
+			if node.children == nil {
+				node.children = make(map[int]*bkNode)
+			}
+			node.children[d] = &bkNode{hash: hash, ids: []int{id}}
+			return
+		}
+		node = child
+	}
+}
+
+// search returns the ids of the hashes within maxDistance of the hash
+func (t *bkTree) search(hash ImageHash, maxDistance int) []int {
+	var ids []int
+	if t.root == nil {
+		return ids
+	}
+	pending := []*bkNode{t.root}
+	for len(pending) > 0 {
+		node := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		d := node.hash.Distance(hash)
+		if d <= maxDistance {
+			ids = append(ids, node.ids...)
+		}
+		for cd, child := range node.children {
+			if cd >= d-maxDistance && cd <= d+maxDistance {
+				pending = append(pending, child)
+			}
+		}
+	}
+	return ids
+}
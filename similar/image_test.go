@@ -0,0 +1,245 @@
+package similar
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// pattern returns an image of smooth waves and a bright square at (sx, sy),
+// so that all hash algorithms see structure at the scale of their thumbnails
+func pattern(w, h int, fx, fy, sx, sy float64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			u, v := float64(x)/float64(w), float64(y)/float64(h)
+			value := 128 + 60*math.Sin(fx*u*math.Pi)*math.Cos(fy*v*math.Pi)
+			if u > sx && u < sx+0.25 && v > sy && v < sy+0.25 {
+				value = 240
+			}
+			g := uint8(value)
+			img.Set(x, y, color.RGBA{g, g / 2, 255 - g, 255})
+		}
+	}
+	return img
+}
+
+// shrink scales down the image by averaging blocks of factor x factor pixels
+func shrink(img image.Image, factor int) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx()/factor, b.Dy()/factor))
+	for y := 0; y < b.Dy()/factor; y++ {
+		for x := 0; x < b.Dx()/factor; x++ {
+			var r, g, bl uint32
+			for dy := 0; dy < factor; dy++ {
+				for dx := 0; dx < factor; dx++ {
+					cr, cg, cb, _ := img.At(x*factor+dx, y*factor+dy).RGBA()
+					r, g, bl = r+cr>>8, g+cg>>8, bl+cb>>8
+				}
+			}
+			n := uint32(factor * factor)
+			out.Set(x, y, color.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), 255})
+		}
+	}
+	return out
+}
+
+func writePNG(t *testing.T, path string, img image.Image) {
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := png.Encode(file, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeJPEG(t *testing.T, path string, img image.Image) {
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := jpeg.Encode(file, img, &jpeg.Options{Quality: 70}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_ImageHash_Distance(t *testing.T) {
+	if d := ImageHash(0).Distance(0xff01); d != 9 {
+		t.Errorf("got %d, expected 9", d)
+	}
+	if s := ImageHash(0xff01).String(); s != "000000000000ff01" {
+		t.Errorf("got %q", s)
+	}
+}
+
+func Test_ImageHashers_are_robust_to_resizing_and_reencoding(t *testing.T) {
+	dir, err := ioutil.TempDir("", "similar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	original := pattern(400, 300, 3, 2, 0.55, 0.2)
+	writePNG(t, filepath.Join(dir, "original.png"), original)
+	writeJPEG(t, filepath.Join(dir, "resized.jpg"), shrink(original, 2))
+	writePNG(t, filepath.Join(dir, "other.png"), pattern(400, 300, 1, 5, 0.1, 0.6))
+
+	for _, hasher := range []ImageHasher{ImageHashers.Average, ImageHashers.Difference, ImageHashers.Perception} {
+		hashes := make(map[string]ImageHash)
+		for _, name := range []string{"original.png", "resized.jpg", "other.png"} {
+			hash, err := HashImageFile(filepath.Join(dir, name), hasher)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hashes[name] = hash
+		}
+		if d := hashes["original.png"].Distance(hashes["resized.jpg"]); d > 4 {
+			t.Errorf("%s: distance of resized copy is %d", hasher.Name(), d)
+		}
+		if d := hashes["original.png"].Distance(hashes["other.png"]); d < 16 {
+			t.Errorf("%s: distance of other image is %d", hasher.Name(), d)
+		}
+	}
+}
+
+func Test_HashImageFile_fails_on_invalid_image(t *testing.T) {
+	file, err := ioutil.TempFile("", "similar*.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("not an image")
+	file.Close()
+
+	_, err = HashImageFile(file.Name(), ImageHashers.Perception)
+	if pathError, ok := err.(*os.PathError); !ok || pathError.Path != file.Name() {
+		t.Errorf("got %v, expected a path error", err)
+	}
+}
+
+func Test_HashImageFile_skips_too_large_image(t *testing.T) {
+	file, err := ioutil.TempFile("", "similar*.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	// a GIF header declaring 65535x65535 pixels
+	file.Write([]byte("GIF89a\xff\xff\xff\xff\x00\x00\x00"))
+	file.Close()
+
+	_, err = HashImageFile(file.Name(), ImageHashers.Perception)
+	if pathError, ok := err.(*os.PathError); !ok || pathError.Path != file.Name() || !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("got %v, expected %v", err, ErrImageTooLarge)
+	}
+}
+
+func Test_ImageHasherByName(t *testing.T) {
+	for _, name := range ImageHasherNames {
+		if hasher, ok := ImageHasherByName(name); !ok || hasher.Name() != name {
+			t.Errorf("%s: got %v", name, hasher)
+		}
+	}
+	if _, ok := ImageHasherByName("md5"); ok {
+		t.Error("expected no hasher for md5")
+	}
+}
+
+func Test_IsImage(t *testing.T) {
+	for path, expected := range map[string]bool{
+		"a.jpg": true, "b.JPEG": true, "c/d.png": true, "e.gif": true,
+		"f.txt": false, "jpg": false, "g.jpg.bak": false,
+	} {
+		if actual := IsImage(path); actual != expected {
+			t.Errorf("%s: got %v, expected %v", path, actual, expected)
+		}
+	}
+}
+
+func Test_GroupImages_groups_similar_images(t *testing.T) {
+	dir, err := ioutil.TempDir("", "similar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	original := pattern(400, 300, 3, 2, 0.55, 0.2)
+	writePNG(t, filepath.Join(dir, "a.png"), original)
+	writePNG(t, filepath.Join(dir, "a-copy.png"), original)
+	writeJPEG(t, filepath.Join(dir, "b.jpg"), shrink(original, 2))
+	writePNG(t, filepath.Join(dir, "c.png"), pattern(400, 300, 1, 5, 0.1, 0.6))
+	ioutil.WriteFile(filepath.Join(dir, "d.png"), []byte("broken"), 0644)
+
+	path := func(name string) string { return filepath.Join(dir, name) }
+	contents := [][]string{
+		{path("a-copy.png"), path("a.png")},
+		{path("b.jpg")},
+		{path("c.png")},
+		{path("d.png")},
+	}
+	groups, errs := GroupImages(context.Background(), contents, ImageHashers.Perception, 8, 2)
+
+	if len(errs) != 1 {
+		t.Errorf("got errors %v, expected one for d.png", errs)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("got %d groups, expected 1", len(groups))
+	}
+	expected := []string{path("a-copy.png"), path("a.png"), path("b.jpg")}
+	if !reflect.DeepEqual(expected, groups[0].Paths) {
+		t.Errorf("got:\n%#v\nexpected:\n%#v", groups[0].Paths, expected)
+	}
+	if d := groups[0].Distances; d[0] != 0 || d[1] != 0 || d[2] != groups[0].MaxDistance() {
+		t.Errorf("unexpected distances: %v", d)
+	}
+}
+
+func Test_GroupImages_does_not_group_different_images(t *testing.T) {
+	dir, err := ioutil.TempDir("", "similar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writePNG(t, filepath.Join(dir, "a.png"), pattern(100, 100, 3, 2, 0.55, 0.2))
+	writePNG(t, filepath.Join(dir, "b.png"), pattern(100, 100, 1, 5, 0.1, 0.6))
+
+	contents := [][]string{{filepath.Join(dir, "a.png")}, {filepath.Join(dir, "b.png")}}
+	groups, errs := GroupImages(context.Background(), contents, ImageHashers.Difference, 8, 1)
+	if len(groups) != 0 || len(errs) != 0 {
+		t.Errorf("got groups %v, errors %v, expected none", groups, errs)
+	}
+}
+
+func Test_bkTree_search_finds_hashes_within_distance(t *testing.T) {
+	tree := &bkTree{}
+	hashes := []ImageHash{0, 1, 3, 0xff, 0xffff, 1}
+	for i, hash := range hashes {
+		tree.add(hash, i)
+	}
+	for _, maxDistance := range []int{0, 1, 2, 8, 16} {
+		for _, query := range []ImageHash{0, 7, 0xfff} {
+			var expected []int
+			for i, hash := range hashes {
+				if query.Distance(hash) <= maxDistance {
+					expected = append(expected, i)
+				}
+			}
+			actual := tree.search(query, maxDistance)
+			if len(actual) != len(expected) {
+				t.Errorf("%x within %d: got %v, expected %v", query, maxDistance, actual, expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package similar
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"math"
+	"os"
+
+	"github.com/janosgyerik/dupfinder/utils"
+)
+
+// ShingleSize is the number of consecutive bytes in each shingle of a file.
+// Files shorter than that have their entire content as a single shingle.
+const ShingleSize = 16
+
+// SignatureSize is the number of hash functions of MinHash signatures.
+// The error of estimated similarities is about 1/sqrt(SignatureSize).
+const SignatureSize = 128
+
+// rollingBase is the multiplier of the Rabin-Karp rolling hash of shingles
+const rollingBase uint64 = 1099511628211
+
+// Signature is the MinHash signature of the set of shingles of a file:
+// the minimum of each hash function over the shingles.
+type Signature []uint64
+
+// Similarity returns the estimated Jaccard similarity of the shingles
+// of the files, between 0 and 1: the fraction of equal minimums
+func (s Signature) Similarity(other Signature) float64 {
+	if len(s) == 0 || len(s) != len(other) {
+		return 0
+	}
+	equal := 0
+	for i := range s {
+		if s[i] == other[i] {
+			equal++
+		}
+	}
+	return float64(equal) / float64(len(s))
+}
+
+// permutations are the multipliers and increments of the hash functions,
+// applied to the mixed rolling hash of each shingle
+var permutations = func() [SignatureSize][2]uint64 {
+	var p [SignatureSize][2]uint64
+	state := uint64(0x5eed)
+	for i := range p {
+		state += 0x9e3779b97f4a7c15
+		p[i][0] = mix(state) | 1
+		state += 0x9e3779b97f4a7c15
+		p[i][1] = mix(state)
+	}
+	return p
+}()
+
+// mix is the finalizer of splitmix64, spreading all input bits
+// to all output bits
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// minHash computes the signatures of contents incrementally
+type minHash struct {
+	signature Signature
+	window    [ShingleSize]byte
+	n         int
+	rolling   uint64
+	outFactor uint64
+}
+
+func newMinHash() *minHash {
+	m := &minHash{signature: make(Signature, SignatureSize), outFactor: 1}
+	for i := range m.signature {
+		m.signature[i] = math.MaxUint64
+	}
+	for i := 0; i < ShingleSize; i++ {
+		m.outFactor *= rollingBase
+	}
+	return m
+}
+
+func (m *minHash) add(b byte) {
+	i := m.n % ShingleSize
+	m.rolling = m.rolling*rollingBase + uint64(b)
+	if m.n >= ShingleSize {
+		m.rolling -= uint64(m.window[i]) * m.outFactor
+	}
+	m.window[i] = b
+	m.n++
+	if m.n >= ShingleSize {
+		m.addShingle(m.rolling)
+	}
+}
+
+func (m *minHash) addShingle(shingle uint64) {
+	x := mix(shingle)
+	for i, p := range permutations {
+		if h := p[0]*x + p[1]; h < m.signature[i] {
+			m.signature[i] = h
+		}
+	}
+}
+
+// sum returns the signature, or nil for empty contents
+func (m *minHash) sum() Signature {
+	if m.n == 0 {
+		return nil
+	}
+	if m.n < ShingleSize {
+		m.addShingle(m.rolling)
+	}
+	return m.signature
+}
+
+// MinHash returns the MinHash signature of the shingles of the content,
+// or nil if it is empty
+func MinHash(r io.Reader) (Signature, error) {
+	m := newMinHash()
+	reader := bufio.NewReader(r)
+	for {
+		b, err := reader.ReadByte()
+		if err == io.EOF {
+			return m.sum(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		m.add(b)
+	}
+}
+
+// MinHashFile returns the MinHash signature of the shingles of the file,
+// or nil if it is empty. Errors are *os.PathError values naming the file.
+func MinHashFile(path string) (Signature, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	signature, err := MinHash(file)
+	if err != nil {
+		return nil, &os.PathError{Op: "read", Path: path, Err: err}
+	}
+	return signature, nil
+}
+
+// Pair is the estimated similarity of two files
+type Pair struct {
+	A, B       string
+	Similarity float64
+}
+
+// TextGroup is a group of similar files, with the similarity of each pair
+// of them. Paths of identical content are listed together, with similarity 1.
+type TextGroup struct {
+	Paths []string
+	Pairs []Pair
+}
+
+// MinSimilarity returns the lowest similarity of the pairs of the group
+func (g TextGroup) MinSimilarity() float64 {
+	min := 1.0
+	for _, pair := range g.Pairs {
+		if pair.Similarity < min {
+			min = pair.Similarity
+		}
+	}
+	return min
+}
+
+// bandRows returns the number of signature rows per band of locality
+// sensitive hashing, to find nearly all pairs of the given similarity
+// as candidates, with as few other candidates as possible
+func bandRows(threshold float64) int {
+	for rows := 16; rows > 1; rows /= 2 {
+		bands := SignatureSize / rows
+		if 1-math.Pow(1-math.Pow(threshold, float64(rows)), float64(bands)) >= 0.999 {
+			return rows
+		}
+	}
+	return 1
+}
+
+// GroupTexts groups the files whose estimated similarity is at least the threshold.
+// Each item of contents lists the paths of identical files, as returned by
+// Tracker.Contents, only the first of them is read. Files are grouped
+// transitively: a file may be less similar to some files of its group,
+// if they are similar to others in between. Empty files are not grouped.
+// Only groups of more than one distinct content are returned.
+// Files are read by the given number of workers, until the context is done.
+func GroupTexts(ctx context.Context, contents [][]string, threshold float64, jobs int) ([]TextGroup, []error) {
+	signatures := make([]Signature, len(contents))
+	errs := utils.Parallel(ctx, len(contents), jobs, func(i int) error {
+		signature, err := MinHashFile(contents[i][0])
+		signatures[i] = signature
+		return err
+	})
+
+	// files with an identical band of rows are candidates to compare
+	sets := newDisjointSets(len(contents))
+	rows := bandRows(threshold)
+	for start := 0; start < SignatureSize; start += rows {
+		buckets := make(map[uint64][]int)
+		for i, signature := range signatures {
+			if signature == nil {
+				continue
+			}
+			key := uint64(0)
+			for _, h := range signature[start : start+rows] {
+				key = mix(key ^ h)
+			}
+			for _, j := range buckets[key] {
+				if sets.find(i) != sets.find(j) && signature.Similarity(signatures[j]) >= threshold {
+					sets.union(i, j)
+				}
+			}
+			buckets[key] = append(buckets[key], i)
+		}
+	}
+
+	var groups []TextGroup
+	for _, members := range sets.groups() {
+		if len(members) < 2 {
+			continue
+		}
+		var group TextGroup
+		var groupSignatures []Signature
+		for _, i := range members {
+			for _, path := range contents[i] {
+				group.Paths = append(group.Paths, path)
+				groupSignatures = append(groupSignatures, signatures[i])
+			}
+		}
+		for i := range group.Paths {
+			for j := i + 1; j < len(group.Paths); j++ {
+				similarity := groupSignatures[i].Similarity(groupSignatures[j])
+				group.Pairs = append(group.Pairs, Pair{group.Paths[i], group.Paths[j], similarity})
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups, failures(ctx, errs)
+}
@@ -0,0 +1,127 @@
+package similar
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// source returns text of numbered lines with random words
+func source(seed int64, lines int) string {
+	words := []string{"func", "return", "if", "else", "for", "range", "nil", "err", "string", "int"}
+	random := rand.New(rand.NewSource(seed))
+	var b strings.Builder
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(&b, "%d:", i)
+		for j := 0; j < 8; j++ {
+			b.WriteString(" " + words[random.Intn(len(words))])
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func minHashOf(t *testing.T, s string) Signature {
+	signature, err := MinHash(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signature
+}
+
+func Test_MinHash_estimates_similarity(t *testing.T) {
+	text := source(1, 200)
+	edited := "// Copyright 2024 Someone Else\n" + text[strings.Index(text, "\n")+1:]
+
+	if s := minHashOf(t, text).Similarity(minHashOf(t, text)); s != 1 {
+		t.Errorf("similarity with itself: got %v", s)
+	}
+	if s := minHashOf(t, text).Similarity(minHashOf(t, edited)); s < 0.9 || s == 1 {
+		t.Errorf("similarity with edited header: got %v", s)
+	}
+	if s := minHashOf(t, text).Similarity(minHashOf(t, source(2, 200))); s > 0.5 {
+		t.Errorf("similarity with other text: got %v", s)
+	}
+}
+
+func Test_MinHash_of_short_and_empty_contents(t *testing.T) {
+	if signature := minHashOf(t, ""); signature != nil {
+		t.Errorf("got %v, expected nil for empty content", signature)
+	}
+	if s := minHashOf(t, "short").Similarity(minHashOf(t, "short")); s != 1 {
+		t.Errorf("got similarity %v of identical short contents", s)
+	}
+	if s := minHashOf(t, "short").Similarity(minHashOf(t, "shorts")); s != 0 {
+		t.Errorf("got similarity %v of different short contents", s)
+	}
+}
+
+func Test_rolling_hash_depends_on_window_only(t *testing.T) {
+	a := minHashOf(t, "xx"+strings.Repeat("0123456789abcdef", 2))
+	b := minHashOf(t, "yyy"+strings.Repeat("0123456789abcdef", 2))
+	if s := a.Similarity(b); s < 0.5 {
+		t.Errorf("got similarity %v, expected the common shingles to match", s)
+	}
+}
+
+func Test_bandRows(t *testing.T) {
+	for threshold, expected := range map[float64]int{0.99: 16, 0.9: 8, 0.5: 2, 0.1: 1} {
+		if actual := bandRows(threshold); actual != expected {
+			t.Errorf("%v: got %d rows, expected %d", threshold, actual, expected)
+		}
+	}
+}
+
+func Test_GroupTexts_groups_similar_files(t *testing.T) {
+	dir, err := ioutil.TempDir("", "similar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	text := source(1, 200)
+	files := map[string]string{
+		"a.go":      text,
+		"a-copy.go": text,
+		"b.go":      "// changed header\n" + text[strings.Index(text, "\n")+1:],
+		"c.go":      source(2, 200),
+		"empty":     "",
+		"empty2":    "",
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+	for name, content := range files {
+		if err := ioutil.WriteFile(path(name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	contents := [][]string{
+		{path("a-copy.go"), path("a.go")},
+		{path("b.go")},
+		{path("c.go")},
+		{path("empty"), path("empty2")},
+		{path("missing")},
+	}
+	groups, errs := GroupTexts(context.Background(), contents, 0.9, 2)
+
+	if len(errs) != 1 {
+		t.Errorf("got errors %v, expected one for the missing file", errs)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("got %d groups, expected 1", len(groups))
+	}
+	expected := []string{path("a-copy.go"), path("a.go"), path("b.go")}
+	if !reflect.DeepEqual(expected, groups[0].Paths) {
+		t.Errorf("got:\n%#v\nexpected:\n%#v", groups[0].Paths, expected)
+	}
+	pairs := groups[0].Pairs
+	if len(pairs) != 3 || pairs[0].Similarity != 1 || pairs[1].Similarity != groups[0].MinSimilarity() || pairs[1].B != path("b.go") {
+		t.Errorf("unexpected pairs: %v", pairs)
+	}
+}
@@ -0,0 +1,64 @@
+package dupfinder
+
+import (
+	"time"
+)
+
+// SnapshotFile is a file added to a tracker, with the digests computed so far
+type SnapshotFile struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Partial string
+	Full    string
+	Sampled string
+}
+
+// Snapshot is the state of a tracker, to resume adding files later
+// without reading again the files already added.
+// Digests are only valid with the hash algorithm of the same name,
+// sampled digests with the same Sampling too.
+type Snapshot struct {
+	Files    []SnapshotFile
+	Sampling *Sampling
+	Hash     string
+}
+
+// Snapshot returns the files added so far, in the order added
+func (t *tracker) Snapshot() Snapshot {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	snapshot := Snapshot{Sampling: t.sampling, Hash: t.hasher.Name()}
+	for _, g := range t.groups {
+		for _, item := range g.items {
+			snapshot.Files = append(snapshot.Files, SnapshotFile{
+				Path:    item.path,
+				Size:    item.size,
+				ModTime: item.info.ModTime(),
+				Partial: item.partial,
+				Full:    item.full,
+				Sampled: item.sampled,
+			})
+		}
+	}
+	return snapshot
+}
+
+// resume sets the digests of the item from the snapshot,
+// if the file has not changed since
+func (t *tracker) resume(item *fileItem) {
+	file, ok := t.resumed[item.path]
+	if !ok || t.resumedHash != t.hasher.Name() || file.Size != item.size || !file.ModTime.Equal(item.info.ModTime()) {
+		return
+	}
+	if file.Partial != "" {
+		item.partial = file.Partial
+	}
+	if file.Full != "" {
+		item.full = file.Full
+	}
+	if file.Sampled != "" && t.resumedSampling != nil && t.sampling != nil && *t.resumedSampling == *t.sampling {
+		item.sampled = file.Sampled
+	}
+}
@@ -0,0 +1,72 @@
+package dupfinder
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/janosgyerik/dupfinder/utils"
+)
+
+func Test_Resume_does_not_read_unchanged_files(t *testing.T) {
+	head := strings.Repeat("h", partialSize)
+	tail := strings.Repeat("t", partialSize)
+	fdata := []fileData{
+		{"f1.txt", head + "foo" + tail},
+		{"f2.txt", head + "foo" + tail},
+		{"f3.txt", head + "bar" + tail},
+		{"f4.txt", "foo"},
+		{"f5.txt", "foo"},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	addAll := func(tracker Tracker) int {
+		counter := &bytesReadCounter{}
+		tracker.SetEventListener(counter)
+		for _, v := range fdata {
+			utils.PanicIfFailed(tracker.Add(path.Join(tempdir, v.relpath)))
+		}
+		return counter.count
+	}
+
+	first := NewTracker()
+	addAll(first)
+	snapshot := first.Snapshot()
+	if len(snapshot.Files) != len(fdata) {
+		t.Fatalf("got %d files in snapshot; expected %d", len(snapshot.Files), len(fdata))
+	}
+
+	resumed := NewTracker(Options.Resume(snapshot))
+	if count := addAll(resumed); count != 0 {
+		t.Errorf("got %d bytes read; expected 0", count)
+	}
+	if !reflect.DeepEqual(first.Dups(), resumed.Dups()) {
+		t.Errorf("got:\n%#v\nexpected:\n%#v", resumed.Dups(), first.Dups())
+	}
+
+	// digests of another hash are not reused
+	if count := addAll(NewTracker(Options.Resume(snapshot), Options.Hash(Hashers.XXH64))); count == 0 {
+		t.Error("digests of another hash were reused")
+	}
+
+	// changed files are read again
+	f3 := path.Join(tempdir, "f3.txt")
+	utils.PanicIfFailed(ioutil.WriteFile(f3, []byte(head+"foo"+tail), 0644))
+	later := time.Now().Add(time.Hour)
+	utils.PanicIfFailed(os.Chtimes(f3, later, later))
+
+	changed := NewTracker(Options.Resume(snapshot))
+	if count := addAll(changed); count == 0 {
+		t.Error("changed file was not read")
+	}
+	expected := [][]string{{"f4.txt", "f5.txt"}, {"f1.txt", "f2.txt", "f3.txt"}}
+	if actual := normalize(changed.Dups()); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("got:\n%#v\nexpected:\n%#v", actual, expected)
+	}
+}
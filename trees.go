@@ -0,0 +1,305 @@
+package dupfinder
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/janosgyerik/dupfinder/utils"
+)
+
+// TreeGroup is a set of directories with identical content:
+// the same file names with the same content, recursively.
+// Only the files added to the tracker are compared: directories that differ
+// only in files excluded by filters, such as a minimum size or exclude
+// patterns, are reported as identical.
+type TreeGroup struct {
+	Paths []string
+	Size  int64
+	Files int
+}
+
+// SubTree is a pair of directories where every file of Sub
+// exists with the same content at the same relative path under Super
+type SubTree struct {
+	Super string
+	Sub   string
+}
+
+// dirNode is a directory containing tracked files, directly or deeper.
+// The content of a file is identified by the index of its group.
+type dirNode struct {
+	path   string
+	files  map[string]int
+	dirs   map[string]*dirNode
+	digest string
+	size   int64
+	count  int
+}
+
+// treeIndex indexes the directories at or under the roots,
+// or all the ancestors of the files if roots is nil
+type treeIndex struct {
+	dirs      map[string]*dirNode
+	fileGroup map[string]int
+	groups    [][]string
+	roots     *dirSet
+}
+
+func newDirNode(path string) *dirNode {
+	return &dirNode{path: path, files: make(map[string]int), dirs: make(map[string]*dirNode)}
+}
+
+// indexed reports whether the directory is at or under the roots
+func (index *treeIndex) indexed(dir string) bool {
+	return index.roots == nil || index.roots.contains(dir)
+}
+
+func (index *treeIndex) dir(path string) *dirNode {
+	if node, ok := index.dirs[path]; ok {
+		return node
+	}
+	node := newDirNode(path)
+	index.dirs[path] = node
+
+	parent := filepath.Dir(path)
+	if parent != path && index.indexed(parent) {
+		index.dir(parent).dirs[filepath.Base(path)] = node
+	}
+	return node
+}
+
+func (t *tracker) treeIndex() *treeIndex {
+	index := &treeIndex{dirs: make(map[string]*dirNode), fileGroup: make(map[string]int), roots: t.roots}
+	for i, g := range t.groups {
+		var paths []string
+		for _, item := range g.items {
+			// links have the same content as the file they link to
+			for _, path := range item.paths() {
+				paths = append(paths, path)
+				index.fileGroup[path] = i
+				if !index.indexed(filepath.Dir(path)) {
+					continue
+				}
+				index.dir(filepath.Dir(path)).files[filepath.Base(path)] = i
+				for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+					node := index.dir(dir)
+					node.size += item.size
+					node.count++
+					if filepath.Dir(dir) == dir || !index.indexed(filepath.Dir(dir)) {
+						break
+					}
+				}
+			}
+		}
+		index.groups = append(index.groups, paths)
+	}
+
+	var nodes []*dirNode
+	for _, node := range index.dirs {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return len(nodes[i].path) > len(nodes[j].path) })
+	for _, node := range nodes {
+		node.digest = node.computeDigest()
+	}
+	return index
+}
+
+// computeDigest combines the sorted entries of the directory,
+// using the digests of sub-directories, which must be computed already
+func (node *dirNode) computeDigest() string {
+	var entries []string
+	for name, groupIndex := range node.files {
+		entries = append(entries, fmt.Sprintf("f\x00%s\x00%d", name, groupIndex))
+	}
+	for name, sub := range node.dirs {
+		entries = append(entries, fmt.Sprintf("d\x00%s\x00%x", name, sub.digest))
+	}
+	sort.Strings(entries)
+
+	h := sha256.New()
+	for _, entry := range entries {
+		fmt.Fprintf(h, "%s\x00", entry)
+	}
+	return string(h.Sum(nil))
+}
+
+func (index *treeIndex) parentOf(node *dirNode) *dirNode {
+	parent := filepath.Dir(node.path)
+	if parent == node.path {
+		return nil
+	}
+	return index.dirs[parent]
+}
+
+func (index *treeIndex) dupTrees() []TreeGroup {
+	byDigest := make(map[string][]*dirNode)
+	for _, node := range index.dirs {
+		byDigest[node.digest] = append(byDigest[node.digest], node)
+	}
+
+	isDup := func(node *dirNode) bool {
+		return node != nil && len(byDigest[node.digest]) > 1
+	}
+
+	var groups []TreeGroup
+	for _, nodes := range byDigest {
+		if len(nodes) < 2 {
+			continue
+		}
+
+		// report only the largest identical trees:
+		// skip when every member is inside an identical parent
+		covered := true
+		for _, node := range nodes {
+			if !isDup(index.parentOf(node)) {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			continue
+		}
+
+		var paths []string
+		for _, node := range nodes {
+			paths = append(paths, node.path)
+		}
+		sort.Strings(paths)
+		groups = append(groups, TreeGroup{Paths: paths, Size: nodes[0].size, Files: nodes[0].count})
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Size != groups[j].Size {
+			return groups[i].Size < groups[j].Size
+		}
+		return groups[i].Paths[0] < groups[j].Paths[0]
+	})
+	return groups
+}
+
+// contains reports whether every file under sub exists under super
+// at the same relative path with the same content
+func contains(super, sub *dirNode) bool {
+	if super.count < sub.count {
+		return false
+	}
+	for name, groupIndex := range sub.files {
+		if other, ok := super.files[name]; !ok || other != groupIndex {
+			return false
+		}
+	}
+	for name, subdir := range sub.dirs {
+		other, ok := super.dirs[name]
+		if !ok || !contains(other, subdir) {
+			return false
+		}
+	}
+	return true
+}
+
+// candidateSupers returns the directories that have some file of the given node
+// at the same relative path with the same content
+func (index *treeIndex) candidateSupers(node *dirNode) []*dirNode {
+	var sample string
+	for _, path := range index.filesUnder(node) {
+		if sample == "" || path < sample {
+			sample = path
+		}
+	}
+
+	rel, _ := filepath.Rel(node.path, sample)
+	suffix := string(filepath.Separator) + rel
+
+	var candidates []*dirNode
+	for _, path := range index.groups[index.fileGroup[sample]] {
+		if path == sample || !strings.HasSuffix(path, suffix) {
+			continue
+		}
+		if candidate, ok := index.dirs[strings.TrimSuffix(path, suffix)]; ok {
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates
+}
+
+// filesUnder returns the files directly in the node, or if it has none,
+// the files of its first sub-directory with files
+func (index *treeIndex) filesUnder(node *dirNode) []string {
+	var paths []string
+	for name := range node.files {
+		paths = append(paths, filepath.Join(node.path, name))
+	}
+	if len(paths) > 0 {
+		return paths
+	}
+
+	var names []string
+	for name := range node.dirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if paths := index.filesUnder(node.dirs[name]); len(paths) > 0 {
+			return paths
+		}
+	}
+	return nil
+}
+
+func (index *treeIndex) subTrees() []SubTree {
+	type pair struct {
+		super, sub string
+	}
+	found := make(map[pair]bool)
+
+	for _, node := range index.dirs {
+		for _, candidate := range index.candidateSupers(node) {
+			if candidate.digest == node.digest || utils.IsUnder(candidate.path, node.path) || utils.IsUnder(node.path, candidate.path) {
+				continue
+			}
+			if contains(candidate, node) {
+				found[pair{candidate.path, node.path}] = true
+			}
+		}
+	}
+
+	// report only the largest pairs:
+	// skip when the parents of directories with the same names are also such a pair
+	var subTrees []SubTree
+	for p := range found {
+		super := index.dirs[p.super]
+		sub := index.dirs[p.sub]
+		superParent := index.parentOf(super)
+		subParent := index.parentOf(sub)
+		if superParent != nil && subParent != nil && filepath.Base(p.super) == filepath.Base(p.sub) {
+			if found[pair{superParent.path, subParent.path}] {
+				continue
+			}
+		}
+		subTrees = append(subTrees, SubTree{Super: p.super, Sub: p.sub})
+	}
+
+	sort.Slice(subTrees, func(i, j int) bool {
+		if subTrees[i].Super != subTrees[j].Super {
+			return subTrees[i].Super < subTrees[j].Super
+		}
+		return subTrees[i].Sub < subTrees[j].Sub
+	})
+	return subTrees
+}
+
+func (t *tracker) DupTrees() []TreeGroup {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.treeIndex().dupTrees()
+}
+
+func (t *tracker) SubTrees() []SubTree {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.treeIndex().subTrees()
+}
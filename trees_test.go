@@ -0,0 +1,128 @@
+package dupfinder
+
+import (
+	"path"
+	"reflect"
+	"testing"
+)
+
+func newTreeTracker(fdata []fileData) Tracker {
+	tracker := NewTracker()
+	for _, v := range fdata {
+		tracker.Add(path.Join(tempdir, v.relpath))
+	}
+	return tracker
+}
+
+func normalizeTrees(groups []TreeGroup) [][]string {
+	var result [][]string
+	for _, g := range groups {
+		result = append(result, normalize([][]string{g.Paths})[0])
+	}
+	return result
+}
+
+func Test_DupTrees_reports_largest_identical_trees(t *testing.T) {
+	fdata := []fileData{
+		{"backup1/photos/a.jpg", "a"},
+		{"backup1/photos/b.jpg", "bb"},
+		{"backup1/docs/c.txt", "ccc"},
+		{"backup2/photos/a.jpg", "a"},
+		{"backup2/photos/b.jpg", "bb"},
+		{"backup2/docs/c.txt", "ccc"},
+		{"other/photos/a.jpg", "a"},
+		{"other/photos/b.jpg", "bb"},
+		{"other/x.txt", "x"},
+		{"renamed/photos/a2.jpg", "a"},
+		{"renamed/photos/b.jpg", "bb"},
+	}
+	expected := [][]string{
+		{"backup1/photos", "backup2/photos", "other/photos"},
+		{"backup1", "backup2"},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	groups := newTreeTracker(fdata).DupTrees()
+	if actual := normalizeTrees(groups); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("got:\n%#v\nexpected:\n%#v", actual, expected)
+	}
+	if groups[1].Size != 6 || groups[1].Files != 3 {
+		t.Fatalf("got size %d and %d files; expected 6 and 3", groups[1].Size, groups[1].Files)
+	}
+}
+
+func Test_SubTrees_reports_largest_containing_trees(t *testing.T) {
+	fdata := []fileData{
+		{"old/photos/a.jpg", "a"},
+		{"old/photos/b.jpg", "bb"},
+		{"old/docs/c.txt", "ccc"},
+		{"new/photos/a.jpg", "a"},
+		{"new/photos/b.jpg", "bb"},
+		{"new/photos/d.jpg", "dddd"},
+		{"new/docs/c.txt", "ccc"},
+		{"new/docs/e.txt", "eeeee"},
+		{"copy/docs/c.txt", "ccc"},
+	}
+	expected := []SubTree{
+		{"new", "copy"},
+		{"new", "old"},
+		{"old", "copy"},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	var actual []SubTree
+	for _, subTree := range newTreeTracker(fdata).SubTrees() {
+		actual = append(actual, SubTree{subTree.Super[len(tempdir)+1:], subTree.Sub[len(tempdir)+1:]})
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("got:\n%#v\nexpected:\n%#v", actual, expected)
+	}
+}
+
+func Test_DupTrees_compares_only_directories_under_roots(t *testing.T) {
+	fdata := []fileData{
+		{"mnt/a/photos/x.jpg", "x"},
+		{"mnt/a/photos/y/z.jpg", "zz"},
+		{"mnt/b/photos/x.jpg", "x"},
+		{"mnt/b/photos/y/z.jpg", "zz"},
+	}
+	createTempFiles(append(fdata, fileData{"mnt/a/other/z", "not scanned"}))
+	defer deleteTempFiles()
+
+	roots := []string{path.Join(tempdir, "mnt/a/photos"), path.Join(tempdir, "mnt/b/photos")}
+	tracker := NewTracker(Options.Roots(roots...))
+	for _, v := range fdata {
+		tracker.Add(path.Join(tempdir, v.relpath))
+	}
+
+	expected := [][]string{{"mnt/a/photos", "mnt/b/photos"}}
+	if actual := normalizeTrees(tracker.DupTrees()); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("got:\n%#v\nexpected:\n%#v", actual, expected)
+	}
+	if subTrees := tracker.SubTrees(); len(subTrees) != 0 {
+		t.Fatalf("got %v; expected none", subTrees)
+	}
+}
+
+func Test_DupTrees_compares_directories_under_nested_roots(t *testing.T) {
+	fdata := []fileData{
+		{"a/b/x.jpg", "x"},
+		{"a/c/x.jpg", "x"},
+	}
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	tracker := NewTracker(Options.Roots(path.Join(tempdir, "a"), path.Join(tempdir, "a/b")))
+	for _, v := range fdata {
+		tracker.Add(path.Join(tempdir, v.relpath))
+	}
+
+	expected := [][]string{{"a/b", "a/c"}}
+	if actual := normalizeTrees(tracker.DupTrees()); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("got:\n%#v\nexpected:\n%#v", actual, expected)
+	}
+}
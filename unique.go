@@ -0,0 +1,68 @@
+package dupfinder
+
+import (
+	"sort"
+)
+
+// paths returns the path of the file and of its known hard links
+// and followed symbolic links
+func (item *fileItem) paths() []string {
+	paths := append([]string{item.path}, item.links...)
+	return append(paths, item.symlinks...)
+}
+
+// Uniques returns the paths of the files that have no duplicate, sorted.
+// Hard links of such files are included, reference files are not.
+func (t *tracker) Uniques() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	uniques := make([]string, 0)
+	for _, g := range t.groups {
+		if item := g.items[0]; len(g.items) == 1 && !item.reference {
+			uniques = append(uniques, item.paths()...)
+		}
+	}
+	sort.Strings(uniques)
+	return uniques
+}
+
+// Missing returns the paths of the files that are not reference files,
+// and have no copy under the directories set by Options.Reference, sorted.
+// For example with a backup as reference directory, the files not backed up.
+func (t *tracker) Missing() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	missing := make([]string, 0)
+	for _, g := range t.groups {
+		if g.hasReference() {
+			continue
+		}
+		for _, item := range g.items {
+			missing = append(missing, item.paths()...)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// Contents returns the paths of each distinct content added, including
+// hard links and reference files. The paths of each content are sorted,
+// and the contents are sorted by their first path.
+func (t *tracker) Contents() [][]string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	contents := make([][]string, 0, len(t.groups))
+	for _, g := range t.groups {
+		var paths []string
+		for _, item := range g.items {
+			paths = append(paths, item.paths()...)
+		}
+		sort.Strings(paths)
+		contents = append(contents, paths)
+	}
+	sort.Slice(contents, func(i, j int) bool { return contents[i][0] < contents[j][0] })
+	return contents
+}
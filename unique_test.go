@@ -0,0 +1,102 @@
+package dupfinder
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/janosgyerik/dupfinder/utils"
+)
+
+func strip(paths []string) []string {
+	stripped := make([]string, 0)
+	for _, p := range paths {
+		stripped = append(stripped, p[len(tempdir)+1:])
+	}
+	return stripped
+}
+
+func Test_Uniques_lists_files_without_duplicates(t *testing.T) {
+	fdata := []fileData{
+		{"f1.txt", "foo"},
+		{"f2.txt", "bar"},
+		{"f3.txt", "foo"},
+		{"f4.txt", "baz"},
+		{"f5.txt", "longer"},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	tracker := NewTracker()
+	for _, v := range fdata {
+		tracker.Add(path.Join(tempdir, v.relpath))
+	}
+	utils.PanicIfFailed(os.Link(path.Join(tempdir, "f2.txt"), path.Join(tempdir, "f6.txt")))
+	tracker.Add(path.Join(tempdir, "f6.txt"))
+
+	expected := []string{"f2.txt", "f4.txt", "f5.txt", "f6.txt"}
+	if actual := strip(tracker.Uniques()); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("got:\n%#v\nexpected:\n%#v", actual, expected)
+	}
+}
+
+func Test_Missing_lists_files_without_reference_copy(t *testing.T) {
+	fdata := []fileData{
+		{"backup/a", "apple"},
+		{"backup/c", "cherry"},
+		{"src/a", "apple"},
+		{"src/renamed", "cherry"},
+		{"src/b1", "banana"},
+		{"src/b2", "banana"},
+		{"src/d", "date"},
+		{"src/empty", ""},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	tracker := NewTracker(Options.Reference(path.Join(tempdir, "backup")))
+	for _, v := range fdata {
+		tracker.Add(path.Join(tempdir, v.relpath))
+	}
+
+	expected := []string{"src/b1", "src/b2", "src/d", "src/empty"}
+	if actual := strip(tracker.Missing()); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("got:\n%#v\nexpected:\n%#v", actual, expected)
+	}
+
+	expected = []string{"src/d", "src/empty"}
+	if actual := strip(tracker.Uniques()); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("got uniques:\n%#v\nexpected:\n%#v", actual, expected)
+	}
+}
+
+func Test_Contents_lists_paths_of_each_distinct_content(t *testing.T) {
+	fdata := []fileData{
+		{"f1.txt", "foo"},
+		{"f2.txt", "bar"},
+		{"f3.txt", "foo"},
+		{"f4.txt", "baz"},
+	}
+
+	createTempFiles(fdata)
+	defer deleteTempFiles()
+
+	tracker := NewTracker()
+	for _, v := range fdata {
+		tracker.Add(path.Join(tempdir, v.relpath))
+	}
+	utils.PanicIfFailed(os.Link(path.Join(tempdir, "f2.txt"), path.Join(tempdir, "f0.txt")))
+	tracker.Add(path.Join(tempdir, "f0.txt"))
+
+	expected := [][]string{{"f0.txt", "f2.txt"}, {"f1.txt", "f3.txt"}, {"f4.txt"}}
+	var actual [][]string
+	for _, paths := range tracker.Contents() {
+		actual = append(actual, strip(paths))
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("got:\n%#v\nexpected:\n%#v", actual, expected)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package utils
+
+import (
+	"os"
+	"syscall"
+)
+
+// FileIDOf returns the device and inode of a file,
+// if the platform provides them
+func FileIDOf(info os.FileInfo) (FileID, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return FileID{}, false
+	}
+	return FileID{Device: uint64(stat.Dev), Inode: uint64(stat.Ino)}, true
+}
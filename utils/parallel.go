@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"context"
+	"sync"
+)
+
+// Parallel calls fn for each index in 0..n-1 with the given number of workers,
+// and returns the errors by index. Once the context is done,
+// the remaining indexes fail with its error.
+func Parallel(ctx context.Context, n, jobs int, fn func(i int) error) []error {
+	if jobs < 1 {
+		jobs = 1
+	}
+	errs := make([]error, n)
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := ctx.Err(); err != nil {
+					errs[i] = err
+					continue
+				}
+				errs[i] = fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return errs
+}
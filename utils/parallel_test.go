@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParallel_returns_errors_by_index(t *testing.T) {
+	fail := errors.New("odd")
+	errs := Parallel(context.Background(), 5, 3, func(i int) error {
+		if i%2 == 1 {
+			return fail
+		}
+		return nil
+	})
+	expected := []error{nil, fail, nil, fail, nil}
+	if !reflect.DeepEqual(expected, errs) {
+		t.Errorf("got %v, expected %v", errs, expected)
+	}
+}
+
+func TestParallel_fails_remaining_indexes_once_done(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := Parallel(ctx, 4, 1, func(i int) error {
+		if i == 1 {
+			cancel()
+		}
+		return nil
+	})
+	expected := []error{nil, nil, context.Canceled, context.Canceled}
+	if !reflect.DeepEqual(expected, errs) {
+		t.Errorf("got %v, expected %v", errs, expected)
+	}
+}
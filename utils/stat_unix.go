@@ -0,0 +1,38 @@
+//go:build !windows
+// +build !windows
+
+package utils
+
+import (
+	"os"
+	"syscall"
+)
+
+// OwnerOf returns the user and group owning a file,
+// if the platform provides them
+func OwnerOf(info os.FileInfo) (Owner, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return Owner{}, false
+	}
+	return Owner{Uid: int(stat.Uid), Gid: int(stat.Gid)}, true
+}
+
+// AllocatedSize returns the bytes allocated on disk for a file,
+// which is less than its size for sparse files
+func AllocatedSize(info os.FileInfo) (int64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int64(stat.Blocks) * 512, true
+}
+
+// LinkCount returns the number of hard links to a file
+func LinkCount(info os.FileInfo) (uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(stat.Nlink), true
+}
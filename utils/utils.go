@@ -2,12 +2,16 @@ package utils
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	)
 
-func FileSize(path string) int64 {
+func FileSize(path string) (int64, error) {
 	fileInfo, e := os.Stat(path)
-	PanicIfFailed(e)
-	return fileInfo.Size()
+	if e != nil {
+		return 0, e
+	}
+	return fileInfo.Size(), nil
 }
 
 func IsFile(s string) bool {
@@ -18,6 +22,12 @@ func IsFile(s string) bool {
 	return stat.Mode().IsRegular()
 }
 
+// IsUnder reports whether path is dir or under it, comparing the paths lexically
+func IsUnder(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 func PanicIfFailed(e error) {
 	if e != nil {
 		panic(e)
@@ -45,3 +55,15 @@ func NewUniqueFilter() UniqueFilter {
 	uf.seen = make(map[string]bool)
 	return uf
 }
+
+// FileID identifies a file independently of the paths pointing to it
+type FileID struct {
+	Device uint64
+	Inode  uint64
+}
+
+// Owner is the numeric user and group id owning a file
+type Owner struct {
+	Uid int `json:"uid"`
+	Gid int `json:"gid"`
+}
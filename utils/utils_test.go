@@ -22,13 +22,23 @@ func TestFileSize(t *testing.T) {
 		defer os.Remove(f)
 
 		t.Run(tt.name, func(t *testing.T) {
-			if got := FileSize(f); got != tt.want {
+			got, err := FileSize(f)
+			if err != nil {
+				t.Fatalf("FileSize() failed: %v", err)
+			}
+			if got != tt.want {
 				t.Errorf("FileSize() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
+func TestFileSize_nonexistent(t *testing.T) {
+	if _, err := FileSize("nonexistent"); !os.IsNotExist(err) {
+		t.Errorf("FileSize() error = %v, want not exist error", err)
+	}
+}
+
 func newTempFile(size int64) string {
 	tempfile, err := ioutil.TempFile("", "test")
 	PanicIfFailed(err)
@@ -134,3 +144,111 @@ func Test_UniqueFilter(t *testing.T) {
 		})
 	}
 }
+
+func TestFileIDOf(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "test")
+	PanicIfFailed(err)
+
+	defer os.RemoveAll(tempdir)
+
+	file := filepath.Join(tempdir, "file")
+	ioutil.WriteFile(file, []byte("foo"), 0644)
+
+	link := filepath.Join(tempdir, "link")
+	os.Link(file, link)
+
+	other := filepath.Join(tempdir, "other")
+	ioutil.WriteFile(other, []byte("foo"), 0644)
+
+	fileID := fileIDOfPath(t, file)
+	if linkID := fileIDOfPath(t, link); linkID != fileID {
+		t.Errorf("got %v for hard link; expected %v", linkID, fileID)
+	}
+	if otherID := fileIDOfPath(t, other); otherID == fileID {
+		t.Errorf("got the same id %v for different files", otherID)
+	}
+}
+
+func fileIDOfPath(t *testing.T, path string) FileID {
+	info, err := os.Stat(path)
+	PanicIfFailed(err)
+
+	id, ok := FileIDOf(info)
+	if !ok {
+		t.Skip("file ids not supported on this platform")
+	}
+	return id
+}
+
+func TestOwnerOf(t *testing.T) {
+	f := newTempFile(0)
+	defer os.Remove(f)
+
+	info, err := os.Stat(f)
+	PanicIfFailed(err)
+
+	owner, ok := OwnerOf(info)
+	if !ok {
+		t.Skip("owners not supported on this platform")
+	}
+	if owner.Uid != os.Getuid() || owner.Gid != os.Getgid() {
+		t.Errorf("got %v; expected %d:%d", owner, os.Getuid(), os.Getgid())
+	}
+}
+
+func TestAllocatedSize_sparse(t *testing.T) {
+	f, err := ioutil.TempFile("", "test")
+	PanicIfFailed(err)
+	defer os.Remove(f.Name())
+
+	size := int64(1 << 20)
+	PanicIfFailed(f.Truncate(size))
+	PanicIfFailed(f.Close())
+
+	info, err := os.Stat(f.Name())
+	PanicIfFailed(err)
+
+	allocated, ok := AllocatedSize(info)
+	if !ok {
+		t.Skip("allocated size not supported on this platform")
+	}
+	if allocated >= size {
+		t.Errorf("got %d bytes allocated for an empty sparse file of %d bytes", allocated, size)
+	}
+}
+
+func TestLinkCount(t *testing.T) {
+	f := newTempFile(0)
+	defer os.Remove(f)
+	link := f + ".link"
+	PanicIfFailed(os.Link(f, link))
+	defer os.Remove(link)
+
+	info, err := os.Stat(f)
+	PanicIfFailed(err)
+
+	count, ok := LinkCount(info)
+	if !ok {
+		t.Skip("link counts not supported on this platform")
+	}
+	if count != 2 {
+		t.Errorf("got %d links; expected 2", count)
+	}
+}
+
+func TestIsUnder(t *testing.T) {
+	for _, test := range []struct {
+		dir, path string
+		expected  bool
+	}{
+		{"a", "a", true},
+		{"a", "a/b", true},
+		{"a", "ab", false},
+		{"a/b", "a", false},
+		{"a", "../a/b", false},
+	} {
+		if actual := IsUnder(test.dir, test.path); actual != test.expected {
+			t.Errorf("IsUnder(%q, %q): got %v; expected %v", test.dir, test.path, actual, test.expected)
+		}
+	}
+}